@@ -0,0 +1,234 @@
+// Package apiversion keeps the versions of the api apart. Every version has its route group,
+// /api/v1 and /api/v2, and requests to /api without a version are served by the version the
+// Accept header asks for, application/vnd.myapp.v2+json, or else by the oldest one, which is
+// where the clients from before versioning are. Deprecated versions answer with Deprecation
+// and Sunset headers, and the requests to every version are counted, see Usage, to tell when
+// a version can be retired.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// MediaTypePrefix starts the vendor media types that ask for a version, the version and +json
+// follow it
+const MediaTypePrefix = "application/vnd.myapp."
+
+// Version is a version of the api
+type Version struct {
+	// Name is the name of the version in the url and the media type, e.g. v1
+	Name string
+	// Deprecated is when the version was, or will be, deprecated, zero when it is not
+	Deprecated time.Time
+	// Sunset is when the version stops being served, zero when that is not decided
+	Sunset time.Time
+	// Successor is the url of the version that replaces this one, e.g. /api/v2
+	Successor string
+}
+
+// IsDeprecated reports whether the version has a deprecation date
+func (v Version) IsDeprecated() bool {
+	return !v.Deprecated.IsZero()
+}
+
+// SetHeaders sets the Deprecation, Sunset and Link headers of a deprecated version, RFC 9745
+// and RFC 8594. Versions that are not deprecated get none.
+func (v Version) SetHeaders(h http.Header) {
+	if !v.IsDeprecated() {
+		return
+	}
+
+	h.Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+	if !v.Sunset.IsZero() {
+		h.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if v.Successor != "" {
+		h.Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", v.Successor))
+	}
+}
+
+// Versions are the versions of the api, oldest first
+type Versions []Version
+
+// Find returns the version with name
+func (vs Versions) Find(name string) (Version, bool) {
+	for _, v := range vs {
+		if v.Name == name {
+			return v, true
+		}
+	}
+
+	return Version{}, false
+}
+
+// Default returns the version of requests that do not ask for one, the oldest
+func (vs Versions) Default() Version {
+	if len(vs) == 0 {
+		return Version{}
+	}
+
+	return vs[0]
+}
+
+// FromAccept returns the version the Accept header of r asks for with a vendor media type,
+// v2 for application/vnd.myapp.v2+json, or "" when it does not ask for one
+func FromAccept(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || !strings.HasPrefix(mediaType, MediaTypePrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(mediaType, MediaTypePrefix)
+		if i := strings.Index(name, "+"); i >= 0 {
+			name = name[:i]
+		}
+
+		return name
+	}
+
+	return ""
+}
+
+type contextKey struct{}
+
+// WithVersion returns a context for a request to the version name
+func WithVersion(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// FromContext returns the version of the request of ctx, or "" outside of the api
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(contextKey{}).(string)
+	return name
+}
+
+// VersionUsage is how much a version is used
+type VersionUsage struct {
+	// Requests is the number of requests to the version
+	Requests int64 `json:"requests"`
+	// Unversioned is how many of them did not ask for a version in the url
+	Unversioned int64 `json:"unversioned"`
+	// LastRequest is when the version was last requested
+	LastRequest time.Time `json:"last_request"`
+}
+
+var (
+	usageMu sync.Mutex
+	usage   = make(map[string]VersionUsage)
+
+	// usagePool and usageKey are the redis hash the usage is kept in, see UseRedis
+	usagePool *redis.Pool
+	usageKey  string
+)
+
+// UseRedis keeps the usage in the redis hash key of pool, so that it survives restarts and is
+// shared by all the instances of the app. Without it the usage is kept in memory, and counts
+// the requests one instance served since it started.
+func UseRedis(pool *redis.Pool, key string) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	usagePool = pool
+	usageKey = key
+}
+
+// redisUsage returns the redis pool and hash the usage is kept in, a nil pool when it is kept in memory
+func redisUsage() (*redis.Pool, string) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	return usagePool, usageKey
+}
+
+// Count counts a request to the version name, unversioned when the url had no version
+func Count(name string, unversioned bool) error {
+	pool, key := redisUsage()
+	if pool == nil {
+		usageMu.Lock()
+		defer usageMu.Unlock()
+
+		u := usage[name]
+		u.Requests++
+		if unversioned {
+			u.Unversioned++
+		}
+		u.LastRequest = time.Now()
+		usage[name] = u
+
+		return nil
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HINCRBY", key, name+":requests", 1)
+	if err != nil {
+		return err
+	}
+
+	if unversioned {
+		_, err = conn.Do("HINCRBY", key, name+":unversioned", 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("HSET", key, name+":last_request", time.Now().Unix())
+	return err
+}
+
+// Usage returns the usage of the versions that have been requested
+func Usage() (map[string]VersionUsage, error) {
+	pool, key := redisUsage()
+	if pool == nil {
+		usageMu.Lock()
+		defer usageMu.Unlock()
+
+		result := make(map[string]VersionUsage, len(usage))
+		for name, u := range usage {
+			result[name] = u
+		}
+
+		return result, nil
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	fields, err := redis.Int64Map(conn.Do("HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+
+	// the fields are the version and what is counted, v1:requests
+	result := make(map[string]VersionUsage)
+	for field, value := range fields {
+		i := strings.LastIndex(field, ":")
+		if i < 0 {
+			continue
+		}
+
+		name := field[:i]
+		u := result[name]
+		switch field[i+1:] {
+		case "requests":
+			u.Requests = value
+		case "unversioned":
+			u.Unversioned = value
+		case "last_request":
+			u.LastRequest = time.Unix(value, 0)
+		}
+		result[name] = u
+	}
+
+	return result, nil
+}
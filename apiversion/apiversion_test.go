@@ -0,0 +1,163 @@
+package apiversion
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestFromAccept(t *testing.T) {
+	var tests = []struct {
+		accept, want string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"application/vnd.myapp.v2+json", "v2"},
+		{"text/html, application/vnd.myapp.v1+json;q=0.9", "v1"},
+		{"application/vnd.other.v2+json", ""},
+	}
+
+	for _, e := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		r.Header.Set("Accept", e.accept)
+
+		if got := FromAccept(r); got != e.want {
+			t.Errorf("%q: expected %q, got %q", e.accept, e.want, got)
+		}
+	}
+}
+
+func TestVersion_SetHeaders(t *testing.T) {
+	h := make(http.Header)
+	Version{Name: "v2"}.SetHeaders(h)
+	if len(h) != 0 {
+		t.Errorf("expected no headers for a current version, got %v", h)
+	}
+
+	deprecated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	Version{Name: "v1", Deprecated: deprecated, Sunset: sunset, Successor: "/api/v2"}.SetHeaders(h)
+
+	if got := h.Get("Deprecation"); got != "@1767225600" {
+		t.Errorf("expected Deprecation @1767225600, got %q", got)
+	}
+	if got := h.Get("Sunset"); got != "Wed, 01 Jul 2026 00:00:00 GMT" {
+		t.Errorf("unexpected Sunset %q", got)
+	}
+	if got := h.Get("Link"); got != `</api/v2>; rel="successor-version"` {
+		t.Errorf("unexpected Link %q", got)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	versions := Versions{{Name: "v1"}, {Name: "v2"}}
+
+	if versions.Default().Name != "v1" {
+		t.Errorf("expected the oldest version as the default, got %s", versions.Default().Name)
+	}
+	if _, ok := versions.Find("v3"); ok {
+		t.Error("expected v3 not to be found")
+	}
+}
+
+// resetUsage forgets the requests counted so far, and those of the test when it is done
+func resetUsage(t *testing.T) {
+	reset := func() {
+		usageMu.Lock()
+		defer usageMu.Unlock()
+
+		usage = make(map[string]VersionUsage)
+		usagePool = nil
+		usageKey = ""
+	}
+
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestCount(t *testing.T) {
+	resetUsage(t)
+
+	for _, unversioned := range []bool{false, true} {
+		err := Count("test", unversioned)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := usage["test"]
+	if u.Requests != 2 || u.Unversioned != 1 || u.LastRequest.IsZero() {
+		t.Errorf("unexpected usage %+v", u)
+	}
+}
+
+func TestCount_Redis(t *testing.T) {
+	resetUsage(t)
+
+	hash := make(map[string]int64)
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return hashConn{hash}, nil }}
+	UseRedis(pool, "myapp:api-version-usage")
+
+	for _, unversioned := range []bool{false, true, true} {
+		err := Count("v1", unversioned)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hash["v1:requests"] != 3 || hash["v1:unversioned"] != 2 {
+		t.Errorf("unexpected hash %v", hash)
+	}
+
+	usage, err := Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := usage["v1"]
+	if u.Requests != 3 || u.Unversioned != 2 || u.LastRequest.IsZero() {
+		t.Errorf("unexpected usage %+v", u)
+	}
+}
+
+// hashConn is a redis connection to a single hash, for the commands Count and Usage send
+type hashConn struct {
+	hash map[string]int64
+}
+
+func (c hashConn) Do(command string, args ...interface{}) (interface{}, error) {
+	switch command {
+	case "HINCRBY":
+		c.hash[args[1].(string)] += int64(args[2].(int))
+		return c.hash[args[1].(string)], nil
+	case "HSET":
+		c.hash[args[1].(string)] = args[2].(int64)
+		return int64(1), nil
+	case "HGETALL":
+		var reply []interface{}
+		for field, value := range c.hash {
+			reply = append(reply, []byte(field), []byte(strconv.FormatInt(value, 10)))
+		}
+		return reply, nil
+	}
+
+	return nil, fmt.Errorf("unexpected command %s", command)
+}
+
+func (c hashConn) Close() error                      { return nil }
+func (c hashConn) Err() error                        { return nil }
+func (c hashConn) Send(string, ...interface{}) error { return errors.New("not supported") }
+func (c hashConn) Flush() error                      { return nil }
+func (c hashConn) Receive() (interface{}, error)     { return nil, errors.New("not supported") }
@@ -0,0 +1,162 @@
+// Package apperror is the error model of the app. Handlers return an *Error, or any error,
+// and Render answers with it: application/problem+json (RFC 7807) for api clients and the
+// error page for browsers.
+//
+//	user, err := users.Find(id)
+//	if errors.Is(err, data.ErrNotFound) {
+//		return apperror.NotFound("user_not_found", "there is no user with this id")
+//	} else if err != nil {
+//		return err // rendered as a 500, the cause is logged
+//	}
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"myapp/binding"
+	"myapp/data"
+)
+
+// maxStackDepth is how many callers are recorded for the stack traces shown in debug mode
+const maxStackDepth = 32
+
+// Error is an error with what the client should be told about it
+type Error struct {
+	// Code tells the kind of error apart for programs, e.g. user_not_found
+	Code string
+	// Status is the http status of the response
+	Status int
+	// Detail is the explanation for people, it is shown to the client
+	Detail string
+	// Fields are the errors by field of input that is not valid
+	Fields map[string]string
+	// Cause is the error that caused this one, it is logged but never shown to the client,
+	// other than in the stack trace in debug mode
+	Cause error
+
+	stack []uintptr
+}
+
+// New returns an error with status, code and detail
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail, stack: callers()}
+}
+
+// Wrap returns an error with status, code and detail, caused by cause
+func Wrap(cause error, status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail, Cause: cause, stack: callers()}
+}
+
+// BadRequest returns a 400 error
+func BadRequest(code, detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: code, Detail: detail, stack: callers()}
+}
+
+// Unauthorized returns a 401 error
+func Unauthorized(code, detail string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: code, Detail: detail, stack: callers()}
+}
+
+// Forbidden returns a 403 error
+func Forbidden(code, detail string) *Error {
+	return &Error{Status: http.StatusForbidden, Code: code, Detail: detail, stack: callers()}
+}
+
+// NotFound returns a 404 error
+func NotFound(code, detail string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: code, Detail: detail, stack: callers()}
+}
+
+// Conflict returns a 409 error
+func Conflict(code, detail string) *Error {
+	return &Error{Status: http.StatusConflict, Code: code, Detail: detail, stack: callers()}
+}
+
+// Invalid returns a 422 error with the errors by field
+func Invalid(detail string, fields map[string]string) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Code: "invalid_input", Detail: detail, Fields: fields, stack: callers()}
+}
+
+// Internal returns a 500 error caused by cause, the client is not told what went wrong
+func Internal(cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_error", Cause: cause, stack: callers()}
+}
+
+func (e *Error) Error() string {
+	message := e.Code
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	if e.Cause != nil {
+		message += ": " + e.Cause.Error()
+	}
+
+	return message
+}
+
+// Unwrap returns the cause, so that errors.Is and errors.As see it
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Title returns the summary of the status, e.g. Not Found
+func (e *Error) Title() string {
+	return http.StatusText(e.Status)
+}
+
+// StackTrace returns where the error was made, one function and line per line
+func (e *Error) StackTrace() string {
+	var b strings.Builder
+
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+// From returns err as an *Error. The errors of binding and of the models get the status
+// that fits them, other errors are internal errors.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var bindErr *binding.Error
+	switch {
+	case errors.As(err, &bindErr) && len(bindErr.Fields) > 0:
+		return &Error{Status: bindErr.Status, Code: "invalid_input", Detail: bindErr.Message, Fields: bindErr.Fields, Cause: err, stack: callers()}
+	case errors.As(err, &bindErr):
+		return &Error{Status: bindErr.Status, Code: "bad_request", Detail: bindErr.Message, Cause: err, stack: callers()}
+	case errors.Is(err, data.ErrNotFound):
+		return &Error{Status: http.StatusNotFound, Code: "not_found", Detail: "the record does not exist", Cause: err, stack: callers()}
+	case errors.Is(err, data.ErrStaleRecord):
+		return &Error{Status: http.StatusConflict, Code: "stale_record", Detail: "the record has been changed since it was read", Cause: err, stack: callers()}
+	}
+
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_error", Cause: err, stack: callers()}
+}
+
+// callers returns the stack of the function that made the error
+func callers() []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	// skip runtime.Callers, callers and the constructor
+	n := runtime.Callers(3, pcs)
+
+	return pcs[:n]
+}
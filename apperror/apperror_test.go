@@ -0,0 +1,97 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"myapp/binding"
+	"myapp/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jimmitjoo/gemquick"
+)
+
+func TestFrom(t *testing.T) {
+	var tests = []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"app error", NotFound("user_not_found", "no user"), http.StatusNotFound, "user_not_found"},
+		{"wrapped app error", fmt.Errorf("finding: %w", Forbidden("nope", "no")), http.StatusForbidden, "nope"},
+		{"bad body", &binding.Error{Status: http.StatusBadRequest, Message: "bad json"}, http.StatusBadRequest, "bad_request"},
+		{"invalid body", &binding.Error{Status: http.StatusUnprocessableEntity, Fields: map[string]string{"name": "required"}}, http.StatusUnprocessableEntity, "invalid_input"},
+		{"not found", fmt.Errorf("find: %w", data.ErrNotFound), http.StatusNotFound, "not_found"},
+		{"stale", data.ErrStaleRecord, http.StatusConflict, "stale_record"},
+		{"other", errors.New("connection refused"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, e := range tests {
+		got := From(e.err)
+		if got.Status != e.status || got.Code != e.code {
+			t.Errorf("%s: expected %d %s, got %d %s", e.name, e.status, e.code, got.Status, got.Code)
+		}
+	}
+}
+
+func TestError_Unwrap(t *testing.T) {
+	cause := errors.New("connection refused")
+
+	if !errors.Is(Internal(cause), cause) {
+		t.Error("expected the error to unwrap to its cause")
+	}
+}
+
+func TestRender(t *testing.T) {
+	var tests = []struct {
+		name  string
+		debug bool
+		err   error
+	}{
+		{"invalid", false, Invalid("the user is not valid", map[string]string{"email": "taken"})},
+		{"internal", false, errors.New("connection refused")},
+		{"internal in debug", true, errors.New("connection refused")},
+	}
+
+	for _, e := range tests {
+		app := &gemquick.Gemquick{Debug: e.debug, ErrorLog: log.New(io.Discard, "", 0)}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/users/5", nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+
+		Render(app, w, r, e.err)
+
+		appErr := From(e.err)
+		if w.Code != appErr.Status {
+			t.Errorf("%s: expected status %d, got %d", e.name, appErr.Status, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != ProblemContentType {
+			t.Errorf("%s: expected %s, got %s", e.name, ProblemContentType, got)
+		}
+
+		var problem Problem
+		err := json.NewDecoder(w.Body).Decode(&problem)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		if problem.Status != appErr.Status || problem.Code != appErr.Code || problem.Instance != "/api/users/5" {
+			t.Errorf("%s: unexpected problem %+v", e.name, problem)
+		}
+		if len(problem.Errors) != len(appErr.Fields) {
+			t.Errorf("%s: expected errors %v, got %v", e.name, appErr.Fields, problem.Errors)
+		}
+
+		// the cause of server errors is only shown in debug mode
+		if e.debug != strings.Contains(problem.Stack, "connection refused") {
+			t.Errorf("%s: unexpected stack %q", e.name, problem.Stack)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package apperror
+
+import (
+	"encoding/json"
+	"myapp/negotiate"
+	"net/http"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jimmitjoo/gemquick"
+)
+
+// ProblemContentType is the content type of problem details, RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// ErrorView is the Jet view of the error page, it gets the Problem as the variable problem
+const ErrorView = "error"
+
+// Problem is the body of problem+json responses. Besides the members of RFC 7807 it has the
+// code of the error, the errors by field, the id of the request and, in debug mode, the
+// stack trace.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Stack     string            `json:"stack,omitempty"`
+}
+
+// NewProblem returns the problem details of e for the request r, with the stack trace and the
+// cause when debug is true
+func NewProblem(r *http.Request, e *Error, debug bool) Problem {
+	problem := Problem{
+		// the code tells the problems apart, there are no pages that document them
+		Type:      "about:blank",
+		Title:     e.Title(),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		Errors:    e.Fields,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+
+	if debug {
+		problem.Stack = e.StackTrace()
+		if e.Cause != nil {
+			problem.Stack = e.Cause.Error() + "\n\n" + problem.Stack
+		}
+	}
+
+	return problem
+}
+
+// Render answers r with err: the error page for browsers and problem+json for everyone else.
+// Server errors are logged with their cause, the client only learns that something went wrong.
+func Render(app *gemquick.Gemquick, w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+
+	if e.Status >= http.StatusInternalServerError {
+		app.ErrorLog.Printf("%s %s: %v\n%s", r.Method, r.URL.Path, e, e.StackTrace())
+	}
+
+	problem := NewProblem(r, e, app.Debug)
+
+	// json comes first, so that clients that accept anything, like curl, get json
+	if negotiate.Negotiate(r, ProblemContentType, negotiate.JSON, negotiate.HTML) == negotiate.HTML {
+		vars := make(jet.VarMap)
+		vars.Set("problem", problem)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(e.Status)
+
+		err = app.Render.JetPage(w, r, ErrorView, vars, nil)
+		if err != nil {
+			app.ErrorLog.Println("error rendering the error page:", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(e.Status)
+
+	err = json.NewEncoder(w).Encode(problem)
+	if err != nil {
+		app.ErrorLog.Println("error writing problem:", err)
+	}
+}
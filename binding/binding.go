@@ -0,0 +1,361 @@
+// Package binding decodes requests into structs and validates them, so that every handler
+// reads its input the same way:
+//
+//	var input struct {
+//		ID    int    `path:"id"`
+//		Page  int    `query:"page"`
+//		Email string `json:"email" form:"email" validate:"required,email"`
+//	}
+//
+//	err := binding.Bind(r, &input)
+//
+// The body is decoded by its Content-Type: json by the json tags, urlencoded and multipart
+// forms by the form tags, or the names package validation gives fields without one. Fields
+// with a query tag are read from the query string and fields with a path tag from the url
+// parameters of chi. The struct is validated by its validate tags, or by its Validate method
+// when it has one.
+//
+// Errors are *Error, with the status to answer with and, when the input could be read but
+// is not valid, the errors by field.
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"myapp/validation"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jimmitjoo/gemquick"
+	"github.com/justinas/nosurf"
+)
+
+var (
+	// MaxBodySize is the largest json or urlencoded body Bind reads, in bytes
+	MaxBodySize int64 = 1 << 20
+	// MaxMultipartSize is the largest multipart body Bind reads, in bytes, files included
+	MaxMultipartSize int64 = 32 << 20
+	// MaxMultipartMemory is how much of a multipart body is kept in memory, the rest of the
+	// files is written to temporary files
+	MaxMultipartMemory int64 = 8 << 20
+)
+
+// Validator is implemented by structs that validate themselves, like the models do, Bind
+// calls Validate instead of validating the validate tags. The error is for when the struct
+// could not be checked, e.g. because a query failed, Bind returns it as it is.
+type Validator interface {
+	Validate(v *gemquick.Validation) error
+}
+
+// Error is why a request could not be bound
+type Error struct {
+	// Status is the status to answer the request with, e.g. 400 for a body that is not valid
+	// json and 422 for input that breaks its rules
+	Status  int
+	Message string
+	// Fields are the errors by field, when the input could be read but is not valid
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+
+	fields := make([]string, 0, len(e.Fields))
+	for name, message := range e.Fields {
+		fields = append(fields, name+": "+message)
+	}
+
+	return e.Message + ": " + strings.Join(fields, ", ")
+}
+
+// AddTo adds the errors by field to v, to render them like the errors of a form
+func (e *Error) AddTo(v *gemquick.Validation) {
+	for name, message := range e.Fields {
+		v.AddError(name, message)
+	}
+}
+
+// Bind decodes r into dst, a pointer to a struct, and validates it. The error is an *Error, or
+// the error of a validation that could not run, e.g. because the database is down.
+func Bind(r *http.Request, dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("binding: Bind needs a pointer to a struct, not %T", dst))
+	}
+
+	fields := make(map[string]string)
+
+	err := decodeBody(r, value.Elem(), fields)
+	if err != nil {
+		return err
+	}
+
+	err = decodeValues(value.Elem(), "query", r.URL.Query(), fields)
+	if err != nil {
+		return err
+	}
+
+	err = decodePath(r, value.Elem(), fields)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		return &Error{Status: http.StatusUnprocessableEntity, Message: "the input is not valid", Fields: fields}
+	}
+
+	v := &gemquick.Validation{Errors: make(map[string]string), Data: r.Form}
+	if validator, ok := dst.(Validator); ok {
+		err = validator.Validate(v)
+	} else {
+		err = validation.Struct(v, dst)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !v.Valid() {
+		return &Error{Status: http.StatusUnprocessableEntity, Message: "the input is not valid", Fields: v.Errors}
+	}
+
+	return nil
+}
+
+// decodeBody decodes the body of r into dst by its content type
+func decodeBody(r *http.Request, dst reflect.Value, fields map[string]string) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return &Error{Status: http.StatusUnsupportedMediaType, Message: "the body has no Content-Type"}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &Error{Status: http.StatusUnsupportedMediaType, Message: "the Content-Type is not valid"}
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		r.Body = limitBody(r.Body, MaxBodySize)
+		return decodeJSON(r.Body, dst, fields)
+	case mediaType == "application/x-www-form-urlencoded":
+		r.Body = limitBody(r.Body, MaxBodySize)
+		err = r.ParseForm()
+		if err != nil {
+			return bodyError(err, "the form")
+		}
+		return decodeForm(dst, r.PostForm, nil, fields)
+	case mediaType == "multipart/form-data":
+		r.Body = limitBody(r.Body, MaxMultipartSize)
+		err = r.ParseMultipartForm(MaxMultipartMemory)
+		if err != nil {
+			return bodyError(err, "the form")
+		}
+		return decodeForm(dst, url.Values(r.MultipartForm.Value), r.MultipartForm.File, fields)
+	}
+
+	return &Error{Status: http.StatusUnsupportedMediaType, Message: fmt.Sprintf("%s bodies are not supported", mediaType)}
+}
+
+func decodeJSON(body io.Reader, dst reflect.Value, fields map[string]string) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst.Addr().Interface())
+
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeError) && typeError.Field != "":
+		fields[typeError.Field] = "must be " + describeKind(typeError.Type.Kind())
+		return nil
+	case err != nil && strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		return &Error{Status: http.StatusBadRequest, Message: "the body has an " + strings.TrimPrefix(err.Error(), "json: ")}
+	case err != nil:
+		return bodyError(err, "the json")
+	}
+
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return &Error{Status: http.StatusBadRequest, Message: "the body must have a single json value"}
+	}
+
+	return nil
+}
+
+// decodeForm sets the fields of dst from the form values and files, by the names package
+// validation gives them. Form values that no field has are rejected, the csrf token aside.
+func decodeForm(dst reflect.Value, values url.Values, files map[string][]*multipart.FileHeader, fields map[string]string) error {
+	known := map[string]bool{nosurf.FormFieldName: true}
+
+	err := eachField(dst, func(field reflect.Value, structField reflect.StructField) error {
+		if structField.Tag.Get("query") != "" || structField.Tag.Get("path") != "" {
+			return nil
+		}
+
+		if strings.Split(structField.Tag.Get("form"), ",")[0] == "-" {
+			return nil
+		}
+
+		name := validation.FieldName(structField)
+		known[name] = true
+
+		if fileHeaders, ok := files[name]; ok && setFiles(field, fileHeaders) {
+			return nil
+		}
+
+		if formValues, ok := values[name]; ok {
+			if err := setValues(field, formValues); err != nil {
+				fields[name] = err.Error()
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range values {
+		if !known[name] {
+			return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("the body has an unknown field %q", name)}
+		}
+	}
+	for name := range files {
+		if !known[name] {
+			return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("the body has an unknown file %q", name)}
+		}
+	}
+
+	return nil
+}
+
+// decodeValues sets the fields of dst with a tag named tag from values, e.g. from the query string
+func decodeValues(dst reflect.Value, tag string, values url.Values, fields map[string]string) error {
+	return eachField(dst, func(field reflect.Value, structField reflect.StructField) error {
+		name := strings.Split(structField.Tag.Get(tag), ",")[0]
+		if name == "" || name == "-" {
+			return nil
+		}
+
+		if fieldValues, ok := values[name]; ok {
+			if err := setValues(field, fieldValues); err != nil {
+				fields[name] = err.Error()
+			}
+		}
+
+		return nil
+	})
+}
+
+// decodePath sets the fields of dst with a path tag from the url parameters of the route. A
+// parameter that does not fit its field means that there is no such resource, so the error
+// is 404.
+func decodePath(r *http.Request, dst reflect.Value, fields map[string]string) error {
+	routeContext := chi.RouteContext(r.Context())
+	if routeContext == nil {
+		return nil
+	}
+
+	params := make(url.Values)
+	for i, key := range routeContext.URLParams.Keys {
+		params.Set(key, routeContext.URLParams.Values[i])
+	}
+
+	pathFields := make(map[string]string)
+
+	err := decodeValues(dst, "path", params, pathFields)
+	if err != nil {
+		return err
+	}
+
+	if len(pathFields) > 0 {
+		return &Error{Status: http.StatusNotFound, Message: http.StatusText(http.StatusNotFound)}
+	}
+
+	return nil
+}
+
+// eachField calls fn with the exported fields of the struct dst, and the fields of the
+// structs it embeds
+func eachField(dst reflect.Value, fn func(field reflect.Value, structField reflect.StructField) error) error {
+	for i := 0; i < dst.NumField(); i++ {
+		structField := dst.Type().Field(i)
+
+		if structField.Anonymous && structField.Type.Kind() == reflect.Struct {
+			err := eachField(dst.Field(i), fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if structField.PkgPath != "" {
+			continue
+		}
+
+		err := fn(dst.Field(i), structField)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errBodyTooLarge is returned by the readers of limitBody
+var errBodyTooLarge = errors.New("the body is too large")
+
+// limitBody returns body limited to max bytes, reading past it fails with errBodyTooLarge
+func limitBody(body io.ReadCloser, max int64) io.ReadCloser {
+	return &limitedBody{ReadCloser: body, remaining: max}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+
+	// read one byte more than allowed, to know whether the body is larger
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// bodyError returns the error for a body that could not be read, what is what was read, e.g. the json
+func bodyError(err error, what string) error {
+	if errors.Is(err, errBodyTooLarge) {
+		return &Error{Status: http.StatusRequestEntityTooLarge, Message: errBodyTooLarge.Error()}
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &Error{Status: http.StatusBadRequest, Message: what + " in the body is incomplete"}
+	}
+
+	return &Error{Status: http.StatusBadRequest, Message: what + " in the body is not valid: " + err.Error()}
+}
@@ -0,0 +1,206 @@
+package binding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jimmitjoo/gemquick"
+)
+
+type signUp struct {
+	ID       int       `json:"-" path:"id"`
+	Page     int       `query:"page"`
+	Tags     []string  `query:"tag"`
+	Name     string    `json:"name" form:"name" validate:"required,min=2"`
+	Email    string    `json:"email" form:"email" validate:"required,email"`
+	Age      *int      `json:"age" form:"age"`
+	Birthday time.Time `json:"birthday" form:"birthday"`
+	Terms    bool      `json:"terms" form:"terms"`
+}
+
+// selfValidating is validated by its own method, like the models are
+type selfValidating struct {
+	Name string `json:"name" validate:"unknown_rule"`
+}
+
+func (s *selfValidating) Validate(v *gemquick.Validation) error {
+	v.Check(s.Name == "ok", "name", "must be ok")
+	return nil
+}
+
+// withRoute returns r with the url parameters of a chi route
+func withRoute(r *http.Request, params map[string]string) *http.Request {
+	routeContext := chi.NewRouteContext()
+	for key, value := range params {
+		routeContext.URLParams.Add(key, value)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+}
+
+func jsonRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/users/7?page=2&tag=a&tag=b", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	return withRoute(r, map[string]string{"id": "7"})
+}
+
+func bindError(t *testing.T, err error) *Error {
+	t.Helper()
+
+	var bindErr *Error
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+
+	return bindErr
+}
+
+func TestBind_JSON(t *testing.T) {
+	var input signUp
+	err := Bind(jsonRequest(`{"name": "Alice", "email": "alice@example.com", "age": 30, "terms": true}`), &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.ID != 7 || input.Page != 2 || strings.Join(input.Tags, ",") != "a,b" {
+		t.Errorf("wrong path or query values: %+v", input)
+	}
+
+	if input.Name != "Alice" || *input.Age != 30 || !input.Terms {
+		t.Errorf("wrong body values: %+v", input)
+	}
+}
+
+func TestBind_Errors(t *testing.T) {
+	var tests = []struct {
+		name   string
+		body   string
+		status int
+		field  string
+	}{
+		{"invalid", `{"name": "A", "email": "alice"}`, http.StatusUnprocessableEntity, "name"},
+		{"wrong type", `{"name": "Alice", "email": "alice@example.com", "age": "old"}`, http.StatusUnprocessableEntity, "age"},
+		{"unknown field", `{"name": "Alice", "admin": true}`, http.StatusBadRequest, ""},
+		{"syntax", `{"name": "Alice"`, http.StatusBadRequest, ""},
+		{"two values", `{"name": "Alice"} {}`, http.StatusBadRequest, ""},
+		{"too large", `{"name": "` + strings.Repeat("a", int(MaxBodySize)) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, e := range tests {
+		var input signUp
+		bindErr := bindError(t, Bind(jsonRequest(e.body), &input))
+
+		if bindErr.Status != e.status {
+			t.Errorf("%s: expected status %d, got %d: %v", e.name, e.status, bindErr.Status, bindErr)
+		}
+
+		if _, ok := bindErr.Fields[e.field]; e.field != "" && !ok {
+			t.Errorf("%s: expected an error for %s, got %v", e.name, e.field, bindErr.Fields)
+		}
+	}
+}
+
+func TestBind_Path(t *testing.T) {
+	r := withRoute(httptest.NewRequest(http.MethodGet, "/users/abc", nil), map[string]string{"id": "abc"})
+
+	var input struct {
+		ID int `path:"id"`
+	}
+
+	if bindError(t, Bind(r, &input)).Status != http.StatusNotFound {
+		t.Error("an id that is not a number should be not found")
+	}
+}
+
+func TestBind_Form(t *testing.T) {
+	form := url.Values{
+		"name":       {"Alice"},
+		"email":      {"alice@example.com"},
+		"age":        {""},
+		"birthday":   {"1990-05-17"},
+		"terms":      {"on"},
+		"csrf_token": {"token"},
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var input signUp
+	err := Bind(r, &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Name != "Alice" || input.Age != nil || !input.Terms || input.Birthday.Day() != 17 {
+		t.Errorf("wrong values: %+v", input)
+	}
+
+	form.Set("admin", "1")
+	r = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if bindError(t, Bind(r, &input)).Status != http.StatusBadRequest {
+		t.Error("unknown form fields should be rejected")
+	}
+}
+
+func TestBind_Multipart(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("name", "Alice")
+	file, _ := writer.CreateFormFile("avatar", "avatar.png")
+	_, _ = file.Write([]byte("png"))
+	_ = writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/avatar", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var input struct {
+		Name   string                `form:"name"`
+		Avatar *multipart.FileHeader `form:"avatar"`
+	}
+
+	err := Bind(r, &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Name != "Alice" || input.Avatar == nil || input.Avatar.Filename != "avatar.png" {
+		t.Errorf("wrong values: %+v", input)
+	}
+}
+
+func TestBind_UnsupportedType(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("<user/>"))
+	r.Header.Set("Content-Type", "application/xml")
+
+	var input signUp
+	if bindError(t, Bind(r, &input)).Status != http.StatusUnsupportedMediaType {
+		t.Error("xml bodies should not be supported")
+	}
+}
+
+func TestBind_Validator(t *testing.T) {
+	var input selfValidating
+
+	bindErr := bindError(t, Bind(jsonRequest(`{"name": "not ok"}`), &input))
+	if bindErr.Fields["name"] != "must be ok" {
+		t.Errorf("expected the error of Validate, got %v", bindErr.Fields)
+	}
+
+	v := &gemquick.Validation{Errors: make(map[string]string)}
+	bindErr.AddTo(v)
+	if v.Valid() {
+		t.Error("AddTo did not add the errors")
+	}
+}
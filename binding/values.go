@@ -0,0 +1,186 @@
+package binding
+
+import (
+	"encoding"
+	"errors"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	fileHeaderType  = reflect.TypeOf(&multipart.FileHeader{})
+	unmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// timeLayouts are the layouts times in forms and query strings are parsed with, in order:
+// what json uses, and what date and datetime-local inputs send
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// setValues sets field from the values of a form or query string field. Slices get every
+// value, other fields the first. The error is the message for the field.
+func setValues(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 && !isUnmarshaler(field) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+		return nil
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	return setValue(field, values[0])
+}
+
+// setValue sets field from the string value
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		if value == "" {
+			// an empty value is no value
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.Type() == timeType {
+		if value == "" {
+			field.Set(reflect.Zero(timeType))
+			return nil
+		}
+
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				field.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+
+		return errors.New("must be a date")
+	}
+
+	// checked after time.Time, which only unmarshals RFC 3339
+	if isUnmarshaler(field) {
+		err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		if err != nil {
+			return errors.New("is not valid")
+		}
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+		return nil
+	case reflect.Slice:
+		// []byte
+		field.SetBytes([]byte(value))
+		return nil
+	case reflect.Bool:
+		if value == "" {
+			field.SetBool(false)
+			return nil
+		}
+		if value == "on" {
+			// what checkboxes without a value send
+			field.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		field.SetBool(b)
+		return nil
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive whole number")
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		field.SetFloat(n)
+	default:
+		return errors.New("can not be set from a form")
+	}
+
+	return nil
+}
+
+// setFiles sets field to the uploaded files, when it is a *multipart.FileHeader or a slice of
+// them, and reports whether it is
+func setFiles(field reflect.Value, files []*multipart.FileHeader) bool {
+	switch {
+	case field.Type() == fileHeaderType:
+		if len(files) > 0 {
+			field.Set(reflect.ValueOf(files[0]))
+		}
+		return true
+	case field.Kind() == reflect.Slice && field.Type().Elem() == fileHeaderType:
+		field.Set(reflect.ValueOf(files))
+		return true
+	}
+
+	return false
+}
+
+func isUnmarshaler(field reflect.Value) bool {
+	return field.CanAddr() && field.Addr().Type().Implements(unmarshalerType)
+}
+
+// describeKind returns what a value of kind is, for the errors of json fields of the wrong type
+func describeKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+
+	return "another type"
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"myapp/apiversion"
 	"myapp/data"
 	"myapp/handlers"
 	"myapp/middleware"
+	"myapp/openapi"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/alexedwards/scs/redisstore"
+	"github.com/gomodule/redigo/redis"
+	// the postgres driver, upper registers the drivers of mysql and sqlite
+	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/jimmitjoo/gemquick"
+	"github.com/jimmitjoo/gemquick/cache"
+	"github.com/joho/godotenv"
 )
 
 func initApplication() *application {
@@ -16,9 +34,14 @@ func initApplication() *application {
 		log.Fatal(err)
 	}
 
+	// Gemquick exits when it can not connect to the database, wait until it can
+	err = waitForDatabase(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// init Gemquick
-	gem := &gemquick.Gemquick{}
-	err = gem.New(path)
+	gem, err := newGemquick(path)
 
 	if err != nil {
 		log.Fatal(err)
@@ -26,25 +49,611 @@ func initApplication() *application {
 
 	gem.AppName = "myapp"
 
+	versions, err := apiVersions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	myMiddleware := &middleware.Middleware{
-		App: gem,
+		App:         gem,
+		HealthToken: os.Getenv("HEALTH_TOKEN"),
+		APIVersions: versions,
 	}
 
 	myHandlers := &handlers.Handlers{
-		App: gem,
+		App:         gem,
+		APIVersions: versions,
 	}
 
 	app := &application{
 		App:        gem,
 		Handlers:   myHandlers,
 		Middleware: myMiddleware,
+		API:        openapi.New(gem.AppName+" api", "1.0.0", "/api/"),
 	}
 
 	app.App.Routes = app.routes()
 
-	app.Models = data.New(app.App.DB.Pool)
+	err = configureRedis(gem)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app.Models, err = data.New(app.App.DB.Pool)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	queryLogger, err := newQueryLogger(gem)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data.EnableQueryLog(queryLogger)
+
+	keyring, err := newKeyring(gem)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data.UseKeyring(keyring)
+
+	if os.Getenv("DATABASE_READ_HOSTS") != "" {
+		replicas, err := openReadReplicas(gem)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		replicas.MonitorHealth(context.Background(), replicaHealthInterval)
+		data.UseReadReplicas(replicas)
+	}
+
+	app.DBs, err = openConnections(gem)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// a model on a connection that is not configured fails here instead of in a request
+	err = app.Models.CheckConnections()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data.FixturesPath = path + "/data/fixtures"
 	myHandlers.Models = app.Models
 	app.Middleware.Models = app.Models
 
 	return app
 }
+
+// newKeyring returns the keys encrypted model fields use. ENCRYPTION_KEYS lists them as
+// id:base64 key pairs, separated by commas, and ENCRYPTION_KEY_ID names the current one.
+// Without them the application KEY is the only key. BLIND_INDEX_KEY is derived from KEY
+// when it is not set.
+func newKeyring(gem *gemquick.Gemquick) (*data.Keyring, error) {
+	keys := map[string][]byte{"app": []byte(gem.EncryptionKey)}
+	current := "app"
+
+	if list := os.Getenv("ENCRYPTION_KEYS"); list != "" {
+		keys = make(map[string][]byte)
+		current = os.Getenv("ENCRYPTION_KEY_ID")
+
+		for _, pair := range strings.Split(list, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid ENCRYPTION_KEYS entry %q", pair)
+			}
+			id, encoded := parts[0], parts[1]
+
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ENCRYPTION_KEYS key %s: %w", id, err)
+			}
+
+			keys[id] = key
+		}
+	}
+
+	indexKey := []byte(os.Getenv("BLIND_INDEX_KEY"))
+	if len(indexKey) == 0 {
+		mac := hmac.New(sha256.New, []byte(gem.EncryptionKey))
+		mac.Write([]byte("blind index"))
+		indexKey = mac.Sum(nil)
+	}
+
+	return data.NewKeyring(current, keys, indexKey)
+}
+
+// newQueryLogger returns the logger for the statements the models run. Slow and failed
+// statements are always logged, every statement is logged when DATABASE_LOG is true.
+func newQueryLogger(gem *gemquick.Gemquick) (*data.QueryLogger, error) {
+	queryLogger := &data.QueryLogger{
+		Warn:          gem.ErrorLog,
+		SlowThreshold: data.DefaultSlowQueryThreshold,
+		Redact:        data.DefaultRedactedColumns,
+	}
+
+	if os.Getenv("DATABASE_LOG") == "true" {
+		queryLogger.Log = gem.InfoLog
+	}
+
+	if ms := os.Getenv("DATABASE_SLOW_QUERY_MS"); ms != "" {
+		threshold, err := time.ParseDuration(ms + "ms")
+		if err != nil {
+			return nil, fmt.Errorf("invalid DATABASE_SLOW_QUERY_MS: %w", err)
+		}
+		queryLogger.SlowThreshold = threshold
+	}
+
+	if columns := os.Getenv("DATABASE_LOG_REDACT"); columns != "" {
+		queryLogger.Redact = nil
+		for _, column := range strings.Split(columns, ",") {
+			queryLogger.Redact = append(queryLogger.Redact, strings.TrimSpace(column))
+		}
+	}
+
+	return queryLogger, nil
+}
+
+// replicaHealthInterval is how often the read replicas are pinged, failing replicas get no reads
+const replicaHealthInterval = 10 * time.Second
+
+// openReadReplicas opens a connection pool for every replica in DATABASE_READ_HOSTS, a comma
+// separated list of hosts, optionally with a port. The other settings are the primary's.
+func openReadReplicas(gem *gemquick.Gemquick) (*data.ReadReplicas, error) {
+	replicas := data.NewReadReplicas()
+
+	settings, err := poolSettings("DATABASE_")
+	if err != nil {
+		return nil, err
+	}
+
+	if seconds := os.Getenv("DATABASE_READ_STICKY_SECONDS"); seconds != "" {
+		window, err := time.ParseDuration(seconds + "s")
+		if err != nil {
+			return nil, fmt.Errorf("invalid DATABASE_READ_STICKY_SECONDS: %w", err)
+		}
+		replicas.StickyWindow = window
+	}
+
+	for _, host := range strings.Split(os.Getenv("DATABASE_READ_HOSTS"), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+
+		port := os.Getenv("DATABASE_PORT")
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host, port = host[:i], host[i+1:]
+		}
+
+		pool, err := openWithRetry(gem, os.Getenv("DATABASE_TYPE"), replicaDSN(host, port), settings)
+		if err != nil {
+			return nil, fmt.Errorf("read replica %s: %w", host, err)
+		}
+
+		err = replicas.Add(host, pool)
+		if err != nil {
+			return nil, fmt.Errorf("read replica %s: %w", host, err)
+		}
+	}
+
+	return replicas, nil
+}
+
+// replicaDSN returns the dsn of the replica at host and port, built like the primary's
+func replicaDSN(host, port string) string {
+	return buildDSN(os.Getenv("DATABASE_TYPE"), host, port,
+		os.Getenv("DATABASE_USER"),
+		os.Getenv("DATABASE_PASS"),
+		os.Getenv("DATABASE_NAME"),
+		os.Getenv("DATABASE_SSL_MODE"))
+}
+
+// buildDSN returns the dsn of a database of dbType, for sqlite name is the path of the file
+func buildDSN(dbType, host, port, user, pass, name, sslMode string) string {
+	switch dbType {
+	case "mysql", "mariadb":
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?collation=utf8mb4_unicode_ci&timeout=5s&parseTime=true&tls=%s&readTimeout=5s&multiStatements=true",
+			user,
+			pass,
+			host,
+			port,
+			name,
+			mysqlTLS(sslMode))
+	case "sqlite", "sqlite3":
+		return "file:" + name + "?_foreign_keys=1&_busy_timeout=5000"
+	default:
+		dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s timezone=UTC connect_timeout=5",
+			host,
+			port,
+			user,
+			name,
+			sslMode)
+
+		if pass != "" {
+			dsn = fmt.Sprintf("%s password=%s", dsn, pass)
+		}
+
+		return dsn
+	}
+}
+
+// mysqlTLS returns the tls option of the mysql driver for DATABASE_SSL_MODE sslMode, which
+// takes the postgres modes, or the values of the tls option itself
+func mysqlTLS(sslMode string) string {
+	switch sslMode {
+	case "", "disable":
+		return "false"
+	case "allow", "prefer":
+		return "preferred"
+	case "require":
+		return "skip-verify"
+	case "verify-ca", "verify-full":
+		return "true"
+	}
+
+	return sslMode
+}
+
+// connectionEnvRegex matches the variables that name the type of a named connection
+var connectionEnvRegex = regexp.MustCompile(`^DB_([A-Z0-9_]+)_TYPE=`)
+
+// openConnections opens the named database connections and adds them for the models that use
+// them. A connection is configured like the primary, with variables prefixed DB_<NAME>_, e.g.
+// DB_ANALYTICS_TYPE, DB_ANALYTICS_HOST, DB_ANALYTICS_PORT, DB_ANALYTICS_USER, DB_ANALYTICS_PASS,
+// DB_ANALYTICS_NAME and DB_ANALYTICS_SSL_MODE, and named after <NAME> in lower case, "analytics".
+func openConnections(gem *gemquick.Gemquick) (map[string]*sql.DB, error) {
+	pools := make(map[string]*sql.DB)
+
+	for _, env := range os.Environ() {
+		match := connectionEnvRegex.FindStringSubmatch(env)
+		if match == nil {
+			continue
+		}
+
+		prefix := "DB_" + match[1] + "_"
+		name := strings.ToLower(match[1])
+		dbType := os.Getenv(prefix + "TYPE")
+
+		dsn := buildDSN(dbType,
+			os.Getenv(prefix+"HOST"),
+			os.Getenv(prefix+"PORT"),
+			os.Getenv(prefix+"USER"),
+			os.Getenv(prefix+"PASS"),
+			os.Getenv(prefix+"NAME"),
+			os.Getenv(prefix+"SSL_MODE"))
+
+		settings, err := poolSettings(prefix)
+		if err != nil {
+			_ = data.CloseConnections()
+			return nil, err
+		}
+
+		pool, err := openWithRetry(gem, dbType, dsn, settings)
+		if err == nil {
+			err = data.AddConnection(name, dbType, pool)
+		}
+		if err != nil {
+			_ = data.CloseConnections()
+			return nil, fmt.Errorf("database connection %s: %w", name, err)
+		}
+
+		pools[name] = pool
+	}
+
+	return pools, nil
+}
+
+// driverName returns the name of the database/sql driver for a database type
+func driverName(dbType string) string {
+	switch dbType {
+	case "postgres", "postgresql":
+		return "pgx"
+	case "mysql", "mariadb":
+		return "mysql"
+	case "sqlite", "sqlite3":
+		return "sqlite3"
+	}
+
+	return dbType
+}
+
+// poolSettings returns the connection pool limits in the variables with prefix, e.g. for
+// DATABASE_: DATABASE_MAX_OPEN_CONNS, DATABASE_MAX_IDLE_CONNS, DATABASE_CONN_MAX_LIFETIME_SECONDS
+// and DATABASE_CONN_MAX_IDLE_TIME_SECONDS. Limits that are not set keep the defaults.
+func poolSettings(prefix string) (data.PoolSettings, error) {
+	var settings data.PoolSettings
+
+	for name, value := range map[string]*int{
+		"MAX_OPEN_CONNS": &settings.MaxOpenConns,
+		"MAX_IDLE_CONNS": &settings.MaxIdleConns,
+	} {
+		if env := os.Getenv(prefix + name); env != "" {
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return settings, fmt.Errorf("invalid %s%s: %w", prefix, name, err)
+			}
+			*value = n
+		}
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"CONN_MAX_LIFETIME_SECONDS":  &settings.ConnMaxLifetime,
+		"CONN_MAX_IDLE_TIME_SECONDS": &settings.ConnMaxIdleTime,
+	} {
+		if env := os.Getenv(prefix + name); env != "" {
+			d, err := time.ParseDuration(env + "s")
+			if err != nil {
+				return settings, fmt.Errorf("invalid %s%s: %w", prefix, name, err)
+			}
+			*value = d
+		}
+	}
+
+	return settings, nil
+}
+
+// apiVersions returns the versions of the api, oldest first. A version is deprecated with
+// API_<VERSION>_DEPRECATED_AT and given a sunset with API_<VERSION>_SUNSET, dates like
+// 2027-06-30, e.g. API_V1_DEPRECATED_AT.
+func apiVersions() (apiversion.Versions, error) {
+	versions := apiversion.Versions{
+		{Name: "v1", Successor: "/api/v2"},
+		{Name: "v2"},
+	}
+
+	for i := range versions {
+		prefix := "API_" + strings.ToUpper(versions[i].Name) + "_"
+
+		for name, value := range map[string]*time.Time{
+			"DEPRECATED_AT": &versions[i].Deprecated,
+			"SUNSET":        &versions[i].Sunset,
+		} {
+			if env := os.Getenv(prefix + name); env != "" {
+				t, err := time.Parse("2006-01-02", env)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s%s: %w", prefix, name, err)
+				}
+				*value = t
+			}
+		}
+	}
+
+	return versions, nil
+}
+
+// defaultConnectTimeout is how long the app waits for its databases when DATABASE_CONNECT_TIMEOUT_SECONDS is not set
+const defaultConnectTimeout = 30 * time.Second
+
+// connectContext returns a context that ends when the app stops waiting for its databases
+func connectContext() (context.Context, context.CancelFunc, error) {
+	timeout := defaultConnectTimeout
+
+	if seconds := os.Getenv("DATABASE_CONNECT_TIMEOUT_SECONDS"); seconds != "" {
+		var err error
+		timeout, err = time.ParseDuration(seconds + "s")
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid DATABASE_CONNECT_TIMEOUT_SECONDS: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	return ctx, cancel, nil
+}
+
+// openWithRetry opens a connection pool with settings to the database at dsn, trying again with
+// backoff until the connect timeout when the database does not answer yet
+func openWithRetry(gem *gemquick.Gemquick, dbType, dsn string, settings data.PoolSettings) (*sql.DB, error) {
+	ctx, cancel, err := connectContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	var pool *sql.DB
+
+	err = data.ConnectRetry(ctx, func() error {
+		var err error
+		pool, err = sql.Open(driverName(dbType), dsn)
+		if err != nil {
+			return err
+		}
+		settings.Apply(pool)
+
+		err = pool.PingContext(ctx)
+		if err != nil {
+			_ = pool.Close()
+		}
+
+		return err
+	}, func(attempt int, err error) {
+		gem.ErrorLog.Printf("connecting to the database failed, attempt %d: %v", attempt, err)
+	})
+
+	return pool, err
+}
+
+// newGemquick returns Gemquick for the app in path, with the pool limits of .env on its database.
+// Gemquick opens the primary database itself and only supports postgres, so other values of
+// DATABASE_TYPE are refused. mysql, mariadb and sqlite can be used for the named connections.
+func newGemquick(path string) (*gemquick.Gemquick, error) {
+	// Gemquick reads .env again in New, it does not override what is set already
+	_ = godotenv.Load(path + "/.env")
+
+	settings, err := poolSettings("DATABASE_")
+	if err != nil {
+		return nil, err
+	}
+
+	dbType := os.Getenv("DATABASE_TYPE")
+	if !gemquickOpensDatabase(dbType) {
+		return nil, fmt.Errorf("DATABASE_TYPE %s is not supported, Gemquick only opens postgres", dbType)
+	}
+
+	gem := &gemquick.Gemquick{}
+
+	err = gem.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gemquick.OpenDB has just opened the pool, the app has not used it yet
+	if gem.DB.Pool != nil {
+		settings.Apply(gem.DB.Pool)
+	}
+
+	return gem, nil
+}
+
+// gemquickOpensDatabase reports whether Gemquick opens the database of DATABASE_TYPE dbType
+func gemquickOpensDatabase(dbType string) bool {
+	return dbType == "" || dbType == "postgres" || dbType == "postgresql"
+}
+
+// waitForDatabase waits until the primary database in .env accepts connections, so that the
+// app can start before it, e.g. in docker compose. Gemquick exits when it can not connect.
+func waitForDatabase(path string) error {
+	// Gemquick reads .env again in New, it does not override what is set already
+	_ = godotenv.Load(path + "/.env")
+
+	dbType := os.Getenv("DATABASE_TYPE")
+	if dbType == "" || !gemquickOpensDatabase(dbType) {
+		return nil
+	}
+
+	ctx, cancel, err := connectContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	dsn := buildDSN(dbType,
+		os.Getenv("DATABASE_HOST"),
+		os.Getenv("DATABASE_PORT"),
+		os.Getenv("DATABASE_USER"),
+		os.Getenv("DATABASE_PASS"),
+		os.Getenv("DATABASE_NAME"),
+		os.Getenv("DATABASE_SSL_MODE"))
+
+	return data.ConnectRetry(ctx, func() error {
+		pool, err := sql.Open(driverName(dbType), dsn)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		return pool.PingContext(ctx)
+	}, func(attempt int, err error) {
+		log.Printf("waiting for the database, attempt %d: %v", attempt, err)
+	})
+}
+
+// configureRedis gives the cache and the sessions a redis pool with the limits in REDIS_MAX_IDLE,
+// REDIS_MAX_ACTIVE, REDIS_IDLE_TIMEOUT_SECONDS, REDIS_MAX_CONN_LIFETIME_SECONDS and REDIS_WAIT
+// when any of them is set, keeps the usage of the api versions in redis, and waits until redis answers.
+// Gemquick makes its pool with fixed limits, it is replaced and closed when a limit is set.
+func configureRedis(gem *gemquick.Gemquick) error {
+	redisCache, ok := gem.Cache.(*cache.RedisCache)
+	if !ok {
+		return nil
+	}
+
+	pool, err := redisPool(redisCache.Conn)
+	if err != nil {
+		return err
+	}
+
+	if pool != redisCache.Conn {
+		gem.Cache = &cache.RedisCache{Conn: pool, Prefix: redisCache.Prefix}
+
+		if os.Getenv("SESSION_TYPE") == "redis" {
+			gem.Session.Store = redisstore.New(pool)
+		}
+
+		// nothing uses the pool Gemquick made anymore
+		err = redisCache.Conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	apiversion.UseRedis(pool, redisCache.Prefix+":api-version-usage")
+
+	ctx, cancel, err := connectContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return data.ConnectRetry(ctx, func() error {
+		conn := pool.Get()
+		defer conn.Close()
+
+		_, err := conn.Do("PING")
+		return err
+	}, func(attempt int, err error) {
+		gem.ErrorLog.Printf("connecting to redis failed, attempt %d: %v", attempt, err)
+	})
+}
+
+// redisPool returns the pool Gemquick created when no REDIS_ limit is set. A redigo pool can
+// not be changed once it is handed out, so otherwise it returns a new pool that dials like
+// Gemquick's, with the limits that are set and Gemquick's for the others.
+func redisPool(gemquickPool *redis.Pool) (*redis.Pool, error) {
+	pool := &redis.Pool{
+		Dial:            gemquickPool.Dial,
+		DialContext:     gemquickPool.DialContext,
+		TestOnBorrow:    gemquickPool.TestOnBorrow,
+		MaxIdle:         gemquickPool.MaxIdle,
+		MaxActive:       gemquickPool.MaxActive,
+		IdleTimeout:     gemquickPool.IdleTimeout,
+		Wait:            gemquickPool.Wait,
+		MaxConnLifetime: gemquickPool.MaxConnLifetime,
+	}
+
+	configured := false
+
+	for name, value := range map[string]*int{
+		"REDIS_MAX_IDLE":   &pool.MaxIdle,
+		"REDIS_MAX_ACTIVE": &pool.MaxActive,
+	} {
+		if env := os.Getenv(name); env != "" {
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*value = n
+			configured = true
+		}
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"REDIS_IDLE_TIMEOUT_SECONDS":      &pool.IdleTimeout,
+		"REDIS_MAX_CONN_LIFETIME_SECONDS": &pool.MaxConnLifetime,
+	} {
+		if env := os.Getenv(name); env != "" {
+			d, err := time.ParseDuration(env + "s")
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*value = d
+			configured = true
+		}
+	}
+
+	// wait for a free connection instead of failing when MaxActive are in use
+	if env := os.Getenv("REDIS_WAIT"); env != "" {
+		wait, err := strconv.ParseBool(env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_WAIT: %w", err)
+		}
+		pool.Wait = wait
+		configured = true
+	}
+
+	if !configured {
+		return gemquickPool, nil
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jimmitjoo/gemquick"
+)
+
+func TestNewGemquick_UnsupportedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, map[string]string{
+		"DATABASE_TYPE": "sqlite",
+		"DATABASE_NAME": filepath.Join(dir, "app.db"),
+	})
+
+	_, err := newGemquick(dir)
+	if err == nil {
+		t.Fatal("expected an error for a database Gemquick does not open")
+	}
+
+	if os.Getenv("DATABASE_TYPE") != "sqlite" {
+		t.Error("DATABASE_TYPE was changed")
+	}
+}
+
+// newSQLiteGemquick returns Gemquick for an app in a temporary directory, started without a
+// database and given a sqlite one, which Gemquick can not open itself
+func newSQLiteGemquick(t *testing.T) *gemquick.Gemquick {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeDotEnv(t, dir, map[string]string{"DATABASE_TYPE": "", "SESSION_TYPE": "cookie"})
+
+	gem, err := newGemquick(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := sql.Open("sqlite3", filepath.Join(dir, "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pool.Close() })
+
+	gem.DB = gemquick.Database{DataType: "sqlite", Pool: pool}
+	t.Setenv("DATABASE_TYPE", "sqlite")
+
+	return gem
+}
+
+// writeDotEnv sets env and writes it to the .env of the app in dir
+func writeDotEnv(t *testing.T, dir string, env map[string]string) {
+	t.Helper()
+
+	dotEnv := ""
+	for name, value := range env {
+		t.Setenv(name, value)
+		dotEnv += name + "=" + value + "\n"
+	}
+
+	err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotEnv), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildDSN_MySQL(t *testing.T) {
+	dsn := buildDSN("mariadb", "localhost", "3306", "user", "pass", "gemquick", "")
+
+	// the migrations have files with more than one statement, and the models scan times
+	for _, option := range []string{"multiStatements=true", "parseTime=true"} {
+		if !strings.Contains(dsn, option) {
+			t.Errorf("expected %s in %s", option, dsn)
+		}
+	}
+}
+
+func TestBuildDSN_MySQLOptions(t *testing.T) {
+	tests := []struct {
+		sslMode string
+		want    string
+	}{
+		{"", "tls=false"},
+		{"disable", "tls=false"},
+		{"prefer", "tls=preferred"},
+		{"require", "tls=skip-verify"},
+		{"verify-full", "tls=true"},
+		{"skip-verify", "tls=skip-verify"},
+	}
+
+	for _, tt := range tests {
+		dsn := buildDSN("mysql", "localhost", "3306", "user", "pass", "gemquick", tt.sslMode)
+
+		if !strings.Contains(dsn, tt.want) {
+			t.Errorf("ssl mode %q: expected %s in %s", tt.sslMode, tt.want, dsn)
+		}
+
+		// the tables are utf8mb4, so is the connection
+		if !strings.Contains(dsn, "collation=utf8mb4_unicode_ci") {
+			t.Errorf("expected the utf8mb4 collation in %s", dsn)
+		}
+	}
+}
+
+func TestRedisPool(t *testing.T) {
+	gemquickPool := &redis.Pool{MaxIdle: 3, MaxActive: 10000, Wait: true}
+
+	for _, name := range []string{"REDIS_MAX_IDLE", "REDIS_MAX_ACTIVE", "REDIS_IDLE_TIMEOUT_SECONDS", "REDIS_MAX_CONN_LIFETIME_SECONDS", "REDIS_WAIT"} {
+		t.Setenv(name, "")
+	}
+
+	pool, err := redisPool(gemquickPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool != gemquickPool {
+		t.Error("got a new pool without any limit set")
+	}
+
+	t.Setenv("REDIS_MAX_ACTIVE", "20")
+
+	pool, err = redisPool(gemquickPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool == gemquickPool || gemquickPool.MaxActive != 10000 {
+		t.Error("the pool Gemquick handed out was changed")
+	}
+
+	if pool.MaxActive != 20 || pool.MaxIdle != 3 || !pool.Wait {
+		t.Errorf("expected MaxActive 20 and Gemquick's other settings, got %+v", pool)
+	}
+}
@@ -1,17 +1,32 @@
 package main
 
 import (
+	"myapp/openapi"
 	"net/http"
 )
 
-func (a *application) get(s string, h http.HandlerFunc) {
+// get registers h for GET requests to s, and describes the route in the api document when it
+// is given an operation
+func (a *application) get(s string, h http.HandlerFunc, op ...openapi.Operation) {
 	a.App.Routes.Get(s, h)
+	a.describe(http.MethodGet, s, op...)
 }
 
-func (a *application) post(s string, h http.HandlerFunc) {
+// post registers h for POST requests to s, and describes the route in the api document when it
+// is given an operation
+func (a *application) post(s string, h http.HandlerFunc, op ...openapi.Operation) {
 	a.App.Routes.Post(s, h)
+	a.describe(http.MethodPost, s, op...)
 }
 
 func (a *application) use(m ...func(http.Handler) http.Handler) {
 	a.App.Routes.Use(m...)
 }
+
+// describe describes the route for method and the full pattern in the api document, for routes
+// registered on the chi router directly, e.g. in a Route group
+func (a *application) describe(method, pattern string, op ...openapi.Operation) {
+	if len(op) > 0 {
+		a.API.Describe(method, pattern, op[0])
+	}
+}
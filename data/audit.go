@@ -0,0 +1,269 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	db2 "github.com/upper/db/v4"
+)
+
+// Auditable is implemented by models whose changes are recorded in the model_changes table.
+// Every create, update and delete records the fields that changed, with their old and new
+// values, and the actor and request from the context of the session, see WithAuditContext.
+//
+// Fields tagged audit:"-" are not recorded, and fields tagged audit:"redact", or of the type
+// EncryptedString, are recorded as changed without their values.
+type Auditable interface {
+	Table() string
+	RecordID() int
+}
+
+// ModelChange is one create, update or delete of an audited record
+type ModelChange struct {
+	ID        int       `db:"id,omitempty" json:"id"`
+	TableName string    `db:"table_name" json:"table_name"`
+	RecordID  int       `db:"record_id" json:"record_id"`
+	Action    string    `db:"action" json:"action"`
+	Changes   string    `db:"changes" json:"-"`
+	ActorID   int       `db:"actor_id" json:"actor_id"`
+	RequestID string    `db:"request_id" json:"request_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+
+	// Diff is Changes decoded, with the fields in alphabetical order
+	Diff []FieldChange `db:"-" json:"diff"`
+}
+
+func (c *ModelChange) Table() string {
+	return "model_changes"
+}
+
+// FieldChange is the old and new value of a field, formatted for people. The old value of a
+// created record and the new value of a deleted one are empty.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// redacted replaces the values of redacted fields in the change history
+const redacted = "[REDACTED]"
+
+var auditActions = map[hookEvent]string{
+	hookCreate: "create",
+	hookUpdate: "update",
+	hookDelete: "delete",
+}
+
+type auditKey struct{}
+
+type auditContext struct {
+	actorID   int
+	requestID string
+}
+
+// WithAuditContext returns a context that attributes the changes made with it to the user
+// with actorID, in the request with requestID. Changes without it are recorded with actor 0.
+func WithAuditContext(ctx context.Context, actorID int, requestID string) context.Context {
+	return context.WithValue(ctx, auditKey{}, auditContext{actorID: actorID, requestID: requestID})
+}
+
+// History returns the changes of the record with id in table, oldest first
+func (m Models) History(table string, id int) ([]ModelChange, error) {
+	var changes []ModelChange
+
+	err := readSession(m.sess).Collection("model_changes").
+		Find(db2.Cond{"table_name": table, "record_id": id}).
+		OrderBy("created_at", "id").
+		All(&changes)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range changes {
+		var diff map[string][2]interface{}
+
+		err := json.Unmarshal([]byte(changes[i].Changes), &diff)
+		if err != nil {
+			return nil, fmt.Errorf("model change %d: %w", changes[i].ID, err)
+		}
+
+		for field, values := range diff {
+			changes[i].Diff = append(changes[i].Diff, FieldChange{
+				Field: field,
+				Old:   formatAuditValue(values[0]),
+				New:   formatAuditValue(values[1]),
+			})
+		}
+
+		sort.Slice(changes[i].Diff, func(a, b int) bool {
+			return changes[i].Diff[a].Field < changes[i].Diff[b].Field
+		})
+	}
+
+	return changes, nil
+}
+
+// audit is the change of one record that is being recorded
+type audit struct {
+	ctx    context.Context
+	action string
+	record Auditable
+	before map[string]interface{}
+}
+
+// startAudit reads the record as it is before event changes it
+func startAudit(ctx context.Context, tx Models, event hookEvent, record Auditable) (*audit, error) {
+	a := &audit{ctx: ctx, action: auditActions[event], record: record}
+
+	if event == hookCreate {
+		return a, nil
+	}
+
+	stored := reflect.New(reflect.Indirect(reflect.ValueOf(record)).Type())
+
+	err := tx.session().Collection(record.Table()).Find(db2.Cond{"id": record.RecordID()}).One(stored.Interface())
+	if err == db2.ErrNoMoreRows {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	a.before = auditFields(stored.Interface())
+
+	return a, nil
+}
+
+// finish records the change, the record is as event left it
+func (a *audit) finish(tx Models) error {
+	var after map[string]interface{}
+	if a.action != "delete" {
+		after = auditFields(a.record)
+	}
+
+	diff := make(map[string][2]interface{})
+
+	for field, value := range a.before {
+		newValue, ok := after[field]
+		if !ok || !auditEqual(value, newValue) {
+			diff[field] = [2]interface{}{value, newValue}
+		}
+	}
+
+	for field, value := range after {
+		if _, ok := a.before[field]; !ok && !auditZero(value) {
+			diff[field] = [2]interface{}{nil, value}
+		}
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+
+	content, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	change := ModelChange{
+		TableName: a.record.Table(),
+		RecordID:  a.record.RecordID(),
+		Action:    a.action,
+		Changes:   string(content),
+		CreatedAt: time.Now(),
+	}
+
+	if values, ok := a.ctx.Value(auditKey{}).(auditContext); ok {
+		change.ActorID = values.actorID
+		change.RequestID = values.requestID
+	}
+
+	_, err = tx.session().Collection(change.Table()).Insert(change)
+
+	return err
+}
+
+// auditFields returns the audited fields of record by column name
+func auditFields(record interface{}) map[string]interface{} {
+	value := reflect.Indirect(reflect.ValueOf(record))
+	fields := make(map[string]interface{})
+
+	for i := 0; i < value.NumField(); i++ {
+		f := value.Type().Field(i)
+
+		column := auditColumn(f)
+		if column == "" || f.Tag.Get("audit") == "-" {
+			continue
+		}
+
+		if f.Tag.Get("audit") == "redact" || f.Type == reflect.TypeOf(EncryptedString("")) {
+			// the values are never stored, only whether they changed
+			fields[column] = redactedValue{value.Field(i).Interface()}
+			continue
+		}
+
+		fields[column] = value.Field(i).Interface()
+	}
+
+	return fields
+}
+
+// redactedValue compares like the value it holds, and marshals to the redacted marker
+type redactedValue struct {
+	value interface{}
+}
+
+func (r redactedValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// auditColumn returns the column of a struct field, or "" for fields that are not stored
+func auditColumn(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+
+	column := strings.Split(f.Tag.Get("db"), ",")[0]
+	if column == "-" {
+		return ""
+	}
+
+	return column
+}
+
+// auditEqual compares field values, times by the instant they describe
+func auditEqual(a, b interface{}) bool {
+	if ra, ok := a.(redactedValue); ok {
+		rb, ok := b.(redactedValue)
+		return ok && auditEqual(ra.value, rb.value)
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// auditZero reports whether value is the zero value of its type, created records only record the fields that are set
+func auditZero(value interface{}) bool {
+	if r, ok := value.(redactedValue); ok {
+		value = r.value
+	}
+
+	return value == nil || reflect.ValueOf(value).IsZero()
+}
+
+// formatAuditValue formats a value decoded from the changes json
+func formatAuditValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
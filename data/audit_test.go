@@ -0,0 +1,58 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAuditFields(t *testing.T) {
+	record := struct {
+		ID       int             `db:"id,omitempty"`
+		Name     string          `db:"name"`
+		Password string          `db:"password" audit:"redact"`
+		Phone    EncryptedString `db:"phone"`
+		Version  int             `db:"version" audit:"-"`
+		Token    Token           `db:"-"`
+		hidden   string
+	}{ID: 1, Name: "Alice", Password: "hash", Phone: "0701234567", Version: 3, hidden: "x"}
+
+	fields := auditFields(&record)
+
+	if len(fields) != 4 {
+		t.Errorf("expected id, name, password and phone, got %v", fields)
+	}
+
+	content, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":1,"name":"Alice","password":"[REDACTED]","phone":"[REDACTED]"}`
+	if string(content) != want {
+		t.Errorf("expected %s, got %s", want, content)
+	}
+}
+
+func TestAuditEqual(t *testing.T) {
+	now := time.Now()
+
+	var tests = []struct {
+		name  string
+		a, b  interface{}
+		equal bool
+	}{
+		{"same string", "a", "a", true},
+		{"other string", "a", "b", false},
+		{"same instant in another zone", now, now.UTC(), true},
+		{"other instant", now, now.Add(time.Second), false},
+		{"same redacted", redactedValue{"hash"}, redactedValue{"hash"}, true},
+		{"changed redacted", redactedValue{"hash"}, redactedValue{"new hash"}, false},
+	}
+
+	for _, e := range tests {
+		if auditEqual(e.a, e.b) != e.equal {
+			t.Errorf("%s: expected equal to be %v", e.name, e.equal)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	db2 "github.com/upper/db/v4"
+)
+
+// ErrNoConnection is returned for a connection name that has not been added with AddConnection
+var ErrNoConnection = errors.New("data: no database connection with that name")
+
+var (
+	connectionsMu sync.RWMutex
+	connections   = make(map[string]*namedConnection)
+)
+
+type namedConnection struct {
+	pool *sql.DB
+	sess db2.Session
+}
+
+// Connector is implemented by models that are stored in another database than the primary
+// one. Connection returns the name the database was added with, see AddConnection, e.g.
+//
+//	func (p *PageView) Connection() string {
+//		return "analytics"
+//	}
+//
+// and the model runs its queries on that database with
+//
+//	func (p *PageView) session() (up.Session, error) {
+//		return modelSession(p, p.sess)
+//	}
+//
+// and modelReadSession for reads, the models make generates do both. Add the model to Models,
+// so that Models.CheckConnections finds a connection that was never added at startup.
+//
+// Transactions do not span databases, so models on other connections are not bound by
+// Models.Tx and Models.WithContext, keep them out of Models.bind.
+type Connector interface {
+	Connection() string
+}
+
+// AddConnection makes the database in pool available to models under name, dbType is its
+// type like in DATABASE_TYPE. Adding a name twice replaces the first connection.
+func AddConnection(name, dbType string, pool *sql.DB) error {
+	sess, err := newSessionFor(dbType, pool)
+	if err != nil {
+		return fmt.Errorf("connection %s: %w", name, err)
+	}
+
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	connections[name] = &namedConnection{pool: pool, sess: sess}
+
+	return nil
+}
+
+// Connection returns the session of the connection with name
+func Connection(name string) (db2.Session, error) {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	c, ok := connections[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoConnection, name)
+	}
+
+	return c.sess, nil
+}
+
+// Connections returns the names of the connections, sorted
+func Connections() []string {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	var names []string
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// CloseConnections closes every connection added with AddConnection and removes them, and
+// closes the read replicas, it returns the first error closing them
+func CloseConnections() error {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	var first error
+
+	if r := currentReplicas(); r != nil {
+		UseReadReplicas(nil)
+
+		err := r.Close()
+		if err != nil {
+			first = fmt.Errorf("read replicas: %w", err)
+		}
+	}
+
+	for name, c := range connections {
+		err := c.pool.Close()
+		if err != nil && first == nil {
+			first = fmt.Errorf("connection %s: %w", name, err)
+		}
+
+		delete(connections, name)
+	}
+
+	return first
+}
+
+// CheckConnections returns an error when a model in m is a Connector whose connection has not
+// been added, call it at startup once the connections are added
+func (m Models) CheckConnections() error {
+	return checkConnections(m)
+}
+
+// checkConnections checks the connections of the Connector fields of the struct models
+func checkConnections(models interface{}) error {
+	v := reflect.New(reflect.TypeOf(models)).Elem()
+	v.Set(reflect.ValueOf(models))
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		c, ok := v.Field(i).Addr().Interface().(Connector)
+		if !ok {
+			continue
+		}
+
+		_, err := Connection(c.Connection())
+		if err != nil {
+			return fmt.Errorf("model %s: %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// modelSession returns the session a model runs its queries on: sess when the model is bound
+// to one, the session of its connection when it is a Connector, and else the primary session.
+// It returns ErrNoConnection for a model naming a connection that was never added.
+func modelSession(model interface{}, sess db2.Session) (db2.Session, error) {
+	if sess != nil {
+		return sess, nil
+	}
+
+	c, ok := model.(Connector)
+	if !ok {
+		return sessionOr(nil), nil
+	}
+
+	return Connection(c.Connection())
+}
+
+// modelReadSession is modelSession for reads, models on the primary database read from its
+// replicas, see readSession
+func modelReadSession(model interface{}, sess db2.Session) (db2.Session, error) {
+	if _, ok := model.(Connector); ok {
+		return modelSession(model, sess)
+	}
+
+	return readSession(sess), nil
+}
@@ -0,0 +1,140 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	db2 "github.com/upper/db/v4"
+)
+
+type analyticsModel struct {
+	sess db2.Session
+}
+
+func (a *analyticsModel) Connection() string {
+	return "analytics"
+}
+
+// addTestConnection adds a sqlite database as the connection name until the test ends
+func addTestConnection(t *testing.T, name string) *sql.DB {
+	pool, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = AddConnection(name, "sqlite", pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = CloseConnections() })
+
+	return pool
+}
+
+func TestModelSession(t *testing.T) {
+	pool := addTestConnection(t, "analytics")
+
+	model := &analyticsModel{}
+	if sess, err := modelSession(model, model.sess); err != nil || sess.Driver() != pool {
+		t.Error("model does not run its queries on its connection", err)
+	}
+
+	var user User
+	if sess, err := modelSession(&user, nil); err != nil || sess != upper {
+		t.Error("model without a connection does not use the primary session", err)
+	}
+
+	if sess, err := modelReadSession(model, model.sess); err != nil || sess.Driver() != pool {
+		t.Error("model does not read from its connection", err)
+	}
+
+	sess, _ := Connection("analytics")
+	bound := &analyticsModel{sess: sess.WithContext(context.Background())}
+	if got, _ := modelSession(bound, bound.sess); got != bound.sess {
+		t.Error("model bound to a session does not use it")
+	}
+}
+
+func TestConnection_Missing(t *testing.T) {
+	_, err := Connection("missing")
+	if !errors.Is(err, ErrNoConnection) {
+		t.Error("expected ErrNoConnection, got", err)
+	}
+
+	_, err = modelSession(&analyticsModel{}, nil)
+	if !errors.Is(err, ErrNoConnection) {
+		t.Error("expected ErrNoConnection for a model on a connection that was not added, got", err)
+	}
+}
+
+// analyticsModels are models with one on the analytics connection
+type analyticsModels struct {
+	Models
+	PageViews analyticsModel
+}
+
+func TestModels_CheckConnections(t *testing.T) {
+	var m Models
+	if err := m.CheckConnections(); err != nil {
+		t.Error("models on the primary need no connection:", err)
+	}
+
+	err := checkConnections(analyticsModels{})
+	if !errors.Is(err, ErrNoConnection) {
+		t.Error("expected ErrNoConnection before the connection is added, got", err)
+	}
+
+	addTestConnection(t, "analytics")
+
+	err = checkConnections(analyticsModels{})
+	if err != nil {
+		t.Error("unexpected error once the connection is added:", err)
+	}
+}
+
+func TestCloseConnections(t *testing.T) {
+	pool := addTestConnection(t, "legacy")
+
+	if names := Connections(); len(names) != 1 || names[0] != "legacy" {
+		t.Error("wrong connections:", names)
+	}
+
+	err := CloseConnections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.Ping() == nil {
+		t.Error("pool is still open")
+	}
+
+	if len(Connections()) != 0 {
+		t.Error("closed connections are still there")
+	}
+}
+
+func TestCloseConnections_Replicas(t *testing.T) {
+	t.Setenv("DATABASE_TYPE", "postgres")
+	_, pools, mocks := newMockReplicas(t, 2)
+	for _, mock := range mocks {
+		mock.ExpectClose()
+	}
+
+	err := CloseConnections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, pool := range pools {
+		if pool.Ping() == nil {
+			t.Errorf("replica %d is still open", i)
+		}
+	}
+
+	if currentReplicas() != nil {
+		t.Error("reads still go to the closed replicas")
+	}
+}
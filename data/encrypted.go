@@ -0,0 +1,274 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix starts every encrypted value, the key id and the ciphertext follow it
+const encryptedPrefix = "enc1"
+
+var keyIDRegex = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// ErrNoKeyring is returned when encrypted fields are used before UseKeyring is called
+var ErrNoKeyring = errors.New("data: no keyring for encrypted fields, call UseKeyring")
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+// Keyring holds the keys encrypted fields are encrypted with. Values are always encrypted
+// with the current key, and decrypted with the key whose id is stored with them, so keys
+// can be rotated by adding a new current key and keeping the old ones until Reencrypt has
+// moved every value to the new key.
+type Keyring struct {
+	current  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring returns a keyring that encrypts with the key named current. The keys are AES
+// keys of 16, 24 or 32 bytes, by their id, and ids are letters and digits. indexKey is the
+// secret BlindIndex hashes with, it must never change, or the indexes have to be rebuilt.
+func NewKeyring(current string, keys map[string][]byte, indexKey []byte) (*Keyring, error) {
+	k := &Keyring{current: current, keys: make(map[string]cipher.AEAD), indexKey: indexKey}
+
+	for id, key := range keys {
+		if !keyIDRegex.MatchString(id) {
+			return nil, fmt.Errorf("data: invalid encryption key id %q", id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("data: encryption key %s: %w", id, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("data: encryption key %s: %w", id, err)
+		}
+
+		k.keys[id] = aead
+	}
+
+	if _, ok := k.keys[current]; !ok {
+		return nil, fmt.Errorf("data: no encryption key with the current id %q", current)
+	}
+
+	if len(indexKey) == 0 {
+		return nil, errors.New("data: the blind index key is empty")
+	}
+
+	return k, nil
+}
+
+// UseKeyring makes encrypted fields use k
+func UseKeyring(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+
+	keyring = k
+}
+
+func currentKeyring() (*Keyring, error) {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+
+	if keyring == nil {
+		return nil, ErrNoKeyring
+	}
+
+	return keyring, nil
+}
+
+// Encrypt encrypts plainText with the current key
+func (k *Keyring) Encrypt(plainText string) (string, error) {
+	aead := k.keys[k.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plainText), []byte(k.current))
+
+	return encryptedPrefix + ":" + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value Encrypt returned, with the key it was encrypted with
+func (k *Keyring) Decrypt(encrypted string) (string, error) {
+	id, sealed, err := splitEncrypted(encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("data: no encryption key with id %q", id)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("data: encrypted value is too short")
+	}
+
+	plainText, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("data: decrypting with key %s: %w", id, err)
+	}
+
+	return string(plainText), nil
+}
+
+// BlindIndex returns a keyed hash of value, to store next to an encrypted column so that the
+// column can be searched by equality, e.g. a phone_index column next to phone.
+// Normalize the value first, e.g. strip spaces from phone numbers, since only equal values
+// have equal hashes.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BlindIndex returns the blind index of value with the keyring in use, see Keyring.BlindIndex
+func BlindIndex(value string) (string, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	return k.BlindIndex(value), nil
+}
+
+// splitEncrypted returns the key id and the sealed bytes of an encrypted value
+func splitEncrypted(encrypted string) (string, []byte, error) {
+	parts := strings.SplitN(encrypted, ":", 3)
+	if len(parts) != 3 || parts[0] != encryptedPrefix {
+		return "", nil, errors.New("data: value is not encrypted")
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("data: encrypted value: %w", err)
+	}
+
+	return parts[1], sealed, nil
+}
+
+// EncryptedString is a string that is encrypted in the database, with the keyring set with
+// UseKeyring. Use it for model fields like any other string, e.g.
+//
+//	Phone EncryptedString `db:"phone"`
+//
+// The empty string is stored as it is, so that it does not need to be decrypted.
+type EncryptedString string
+
+// Value encrypts the string for the database
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	k, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	return k.Encrypt(string(s))
+}
+
+// Scan decrypts a value from the database
+func (s *EncryptedString) Scan(src interface{}) error {
+	var encrypted string
+
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		encrypted = v
+	case []byte:
+		encrypted = string(v)
+	default:
+		return fmt.Errorf("data: can not scan %T into an EncryptedString", src)
+	}
+
+	if encrypted == "" {
+		*s = ""
+		return nil
+	}
+
+	k, err := currentKeyring()
+	if err != nil {
+		return err
+	}
+
+	plainText, err := k.Decrypt(encrypted)
+	if err != nil {
+		return err
+	}
+
+	*s = EncryptedString(plainText)
+
+	return nil
+}
+
+// String returns the decrypted string
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+// Reencrypt encrypts the values in column of table that are encrypted with an old key with
+// the current key, and returns how many it changed. Run it after adding a new current key,
+// the old key can be removed from the keyring once it is done.
+func (m Models) Reencrypt(table, column string) (int, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []map[string]interface{}
+
+	err = m.session().SQL().
+		Select("id", column).
+		From(table).
+		Where(column+" NOT LIKE ?", encryptedPrefix+":"+k.current+":%").
+		And(column+" <> ?", "").
+		All(&rows)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+
+	for _, row := range rows {
+		var value EncryptedString
+
+		err := value.Scan(row[column])
+		if err != nil {
+			return changed, fmt.Errorf("%s %v: %w", table, row["id"], err)
+		}
+
+		_, err = m.session().SQL().Update(table).Set(column, value).Where("id = ?", row["id"]).Exec()
+		if err != nil {
+			return changed, err
+		}
+
+		changed++
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyOne = bytes.Repeat([]byte("1"), 32)
+	testKeyTwo = bytes.Repeat([]byte("2"), 32)
+)
+
+// useTestKeyring makes encrypted fields use a keyring with the keys in keys until the test ends
+func useTestKeyring(t *testing.T, current string, keys map[string][]byte) *Keyring {
+	k, err := NewKeyring(current, keys, []byte("index key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UseKeyring(k)
+	t.Cleanup(func() { UseKeyring(nil) })
+
+	return k
+}
+
+func TestEncryptedString_RoundTrip(t *testing.T) {
+	useTestKeyring(t, "one", map[string][]byte{"one": testKeyOne})
+
+	value, err := EncryptedString("+46 70 123 45 67").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := value.(string)
+	if strings.Contains(encrypted, "123") || !strings.HasPrefix(encrypted, "enc1:one:") {
+		t.Error("value is not encrypted with key one:", encrypted)
+	}
+
+	var phone EncryptedString
+	err = phone.Scan([]byte(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if phone != "+46 70 123 45 67" {
+		t.Error("wrong decrypted value", phone)
+	}
+
+	again, _ := EncryptedString("+46 70 123 45 67").Value()
+	if again == value {
+		t.Error("equal values got equal ciphertexts")
+	}
+}
+
+func TestEncryptedString_Empty(t *testing.T) {
+	value, err := EncryptedString("").Value()
+	if err != nil || value != "" {
+		t.Error("empty string was not stored as it is", value, err)
+	}
+
+	var s EncryptedString = "old"
+	err = s.Scan(nil)
+	if err != nil || s != "" {
+		t.Error("NULL was not scanned as the empty string", s, err)
+	}
+}
+
+func TestEncryptedString_NoKeyring(t *testing.T) {
+	_, err := EncryptedString("secret").Value()
+	if !errors.Is(err, ErrNoKeyring) {
+		t.Error("expected ErrNoKeyring, got", err)
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old := useTestKeyring(t, "one", map[string][]byte{"one": testKeyOne})
+
+	encrypted, err := old.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := useTestKeyring(t, "two", map[string][]byte{"one": testKeyOne, "two": testKeyTwo})
+
+	var s EncryptedString
+	err = s.Scan(encrypted)
+	if err != nil || s != "secret" {
+		t.Fatal("value of the old key could not be decrypted after rotation:", err)
+	}
+
+	value, _ := s.Value()
+	if !strings.HasPrefix(value.(string), "enc1:two:") {
+		t.Error("value was not encrypted with the current key:", value)
+	}
+
+	if old.BlindIndex("secret") != rotated.BlindIndex("secret") {
+		t.Error("blind index changed with the encryption key")
+	}
+
+	withoutOld := useTestKeyring(t, "two", map[string][]byte{"two": testKeyTwo})
+	_, err = withoutOld.Decrypt(encrypted)
+	if err == nil {
+		t.Error("value was decrypted without its key")
+	}
+}
+
+func TestKeyring_Tampered(t *testing.T) {
+	k := useTestKeyring(t, "one", map[string][]byte{"one": testKeyOne, "two": testKeyTwo})
+
+	encrypted, _ := k.Encrypt("secret")
+
+	// claiming another key id must not work, the id is authenticated with the value
+	_, err := k.Decrypt(strings.Replace(encrypted, ":one:", ":two:", 1))
+	if err == nil {
+		t.Error("value with a changed key id was decrypted")
+	}
+
+	// change a character away from the end, the bits of the last one are not all used
+	i := len(encrypted) - 8
+	changed := byte('A')
+	if encrypted[i] == changed {
+		changed = 'B'
+	}
+	_, err = k.Decrypt(encrypted[:i] + string(changed) + encrypted[i+1:])
+	if err == nil {
+		t.Error("changed value was decrypted")
+	}
+
+	_, err = k.Decrypt("secret")
+	if err == nil {
+		t.Error("plain text was decrypted")
+	}
+}
+
+func TestKeyring_BlindIndex(t *testing.T) {
+	k := useTestKeyring(t, "one", map[string][]byte{"one": testKeyOne})
+
+	index, err := BlindIndex("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index != k.BlindIndex("alice@example.com") || index == k.BlindIndex("bob@example.com") {
+		t.Error("blind index is not a function of the value")
+	}
+
+	other, _ := NewKeyring("one", map[string][]byte{"one": testKeyOne}, []byte("another index key"))
+	if other.BlindIndex("alice@example.com") == index {
+		t.Error("blind index does not depend on the index key")
+	}
+}
+
+func TestNewKeyring_Errors(t *testing.T) {
+	var tests = []struct {
+		name     string
+		current  string
+		keys     map[string][]byte
+		indexKey []byte
+	}{
+		{"missing current key", "two", map[string][]byte{"one": testKeyOne}, []byte("i")},
+		{"short key", "one", map[string][]byte{"one": []byte("short")}, []byte("i")},
+		{"bad id", "o:ne", map[string][]byte{"o:ne": testKeyOne}, []byte("i")},
+		{"no index key", "one", map[string][]byte{"one": testKeyOne}, nil},
+	}
+
+	for _, e := range tests {
+		_, err := NewKeyring(e.current, e.keys, e.indexKey)
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FactoryPassword is the plain text password of every user a UserFactory builds
+const FactoryPassword = "password"
+
+var (
+	factoryRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	factoryRandMu sync.Mutex
+	factoryRunID  = factoryRand.Int63n(1000000)
+	factorySeq    uint64
+
+	factoryFirstNames = []string{"Alice", "Bob", "Carla", "David", "Elin", "Frans", "Greta", "Hugo", "Ida", "Jonas", "Karin", "Lars"}
+	factoryLastNames  = []string{"Andersson", "Berg", "Carlsson", "Dahl", "Ek", "Forsberg", "Gustafsson", "Holm", "Isaksson", "Johansson"}
+)
+
+// UserStates are the named states a UserFactory can build users in
+var UserStates = map[string]func(u *User){
+	"inactive": func(u *User) {
+		u.Active = 0
+	},
+}
+
+// TokenStates are the named states a TokenFactory can build tokens in
+var TokenStates = map[string]func(t *Token){
+	"expired": func(t *Token) {
+		t.ExpiresAt = time.Now().Add(-time.Hour)
+	},
+}
+
+// UserFactory builds users with random, but realistic, attributes, so that every test can
+// create the users it needs instead of sharing them
+type UserFactory struct {
+	models Models
+	states []string
+}
+
+// UserFactory returns a factory that persists the users it creates through m
+func (m Models) UserFactory() UserFactory {
+	return UserFactory{models: m}
+}
+
+// State returns a factory that builds users in the named state, see UserStates
+func (f UserFactory) State(name string) UserFactory {
+	f.states = append(append([]string(nil), f.states...), name)
+	return f
+}
+
+// Build returns a user that is not saved, with the states and then the overrides applied
+func (f UserFactory) Build(overrides ...func(u *User)) User {
+	first := factoryPick(factoryFirstNames)
+	last := factoryPick(factoryLastNames)
+
+	user := User{
+		FirstName: first,
+		LastName:  last,
+		Email:     fmt.Sprintf("%s.%s.%s@example.com", strings.ToLower(first), strings.ToLower(last), factoryID()),
+		Password:  FactoryPassword,
+		Active:    1,
+	}
+
+	for _, state := range f.states {
+		apply, ok := UserStates[state]
+		if !ok {
+			panic(fmt.Sprintf("data: unknown user state %q", state))
+		}
+		apply(&user)
+	}
+
+	for _, override := range overrides {
+		override(&user)
+	}
+
+	return user
+}
+
+// Create builds a user like Build does and saves it
+func (f UserFactory) Create(overrides ...func(u *User)) (*User, error) {
+	return f.models.Users.Create(f.Build(overrides...))
+}
+
+// TokenFactory builds tokens for users, see UserFactory
+type TokenFactory struct {
+	models Models
+	states []string
+	user   *User
+}
+
+// TokenFactory returns a factory that persists the tokens it creates through m
+func (m Models) TokenFactory() TokenFactory {
+	return TokenFactory{models: m}
+}
+
+// State returns a factory that builds tokens in the named state, see TokenStates
+func (f TokenFactory) State(name string) TokenFactory {
+	f.states = append(append([]string(nil), f.states...), name)
+	return f
+}
+
+// For returns a factory that builds tokens belonging to user
+func (f TokenFactory) For(user *User) TokenFactory {
+	f.user = user
+	return f
+}
+
+// Build returns a token that is not saved, with the states and then the overrides applied.
+// It belongs to the user given to For, or to no user at all.
+func (f TokenFactory) Build(overrides ...func(t *Token)) (Token, error) {
+	generated, err := f.models.Tokens.GenerateToken(0, 24*time.Hour)
+	if err != nil {
+		return Token{}, err
+	}
+
+	token := *generated
+
+	if f.user != nil {
+		token.UserID = f.user.ID
+		token.FirstName = f.user.FirstName
+		token.Email = f.user.Email
+	}
+
+	for _, state := range f.states {
+		apply, ok := TokenStates[state]
+		if !ok {
+			panic(fmt.Sprintf("data: unknown token state %q", state))
+		}
+		apply(&token)
+	}
+
+	for _, override := range overrides {
+		override(&token)
+	}
+
+	return token, nil
+}
+
+// Create builds a token like Build does and saves it. When no user was given to For a new
+// user is created for the token. Saving a token replaces the other tokens of its user.
+func (f TokenFactory) Create(overrides ...func(t *Token)) (*Token, error) {
+	if f.user == nil {
+		user, err := f.models.UserFactory().Create()
+		if err != nil {
+			return nil, err
+		}
+		f.user = user
+	}
+
+	token, err := f.Build(overrides...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.models.Tokens.Insert(token, *f.user)
+	if err != nil {
+		return nil, err
+	}
+
+	primary := f.models.Primary()
+
+	return primary.Tokens.GetByToken(token.PlainText)
+}
+
+// factoryPick returns a random element of values
+func factoryPick(values []string) string {
+	factoryRandMu.Lock()
+	defer factoryRandMu.Unlock()
+
+	return values[factoryRand.Intn(len(values))]
+}
+
+// factoryID returns an id that is unique within this process, and random between processes
+func factoryID() string {
+	return fmt.Sprintf("%d.%d", factoryRunID, atomic.AddUint64(&factorySeq, 1))
+}
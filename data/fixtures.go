@@ -0,0 +1,168 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	up "github.com/upper/db/v4"
+	"gopkg.in/yaml.v2"
+)
+
+// Fixture holds records to insert into a table. Every record has a key, and other records
+// can use the id of it by having "@<table>.<key>" as the value of a column.
+type Fixture struct {
+	Table string `json:"table" yaml:"table"`
+	// Unique are the columns that decide if a record already exists, all columns are used when it is empty
+	Unique  []string                          `json:"unique" yaml:"unique"`
+	Records map[string]map[string]interface{} `json:"records" yaml:"records"`
+}
+
+// FixtureRefs maps the "<table>.<key>" of loaded fixture records to their ids
+type FixtureRefs map[string]int
+
+// LoadFixtures inserts the records of the yaml or json fixture files, in the order the files,
+// and the fixtures in them, are given. Records that already exist are not inserted again, so
+// loading the same files twice does not add any rows.
+func (m Models) LoadFixtures(paths ...string) (FixtureRefs, error) {
+	refs := make(FixtureRefs)
+
+	err := m.Tx(m.session().Context(), func(tx Models) error {
+		for _, path := range paths {
+			fixtures, err := readFixtures(path)
+			if err != nil {
+				return err
+			}
+
+			for _, fixture := range fixtures {
+				err := tx.loadFixture(fixture, refs)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// loadFixture inserts the records of fixture that do not exist yet, and adds all of them to refs
+func (m Models) loadFixture(fixture Fixture, refs FixtureRefs) error {
+	collection := m.session().Collection(fixture.Table)
+
+	keys := make([]string, 0, len(fixture.Records))
+	for key := range fixture.Records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		record := make(map[string]interface{}, len(fixture.Records[key]))
+		for column, value := range fixture.Records[key] {
+			resolved, err := resolveFixtureValue(value, refs)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", fixture.Table, key, err)
+			}
+			record[column] = resolved
+		}
+
+		unique := fixture.Unique
+		if len(unique) == 0 {
+			for column := range record {
+				unique = append(unique, column)
+			}
+		}
+
+		cond := up.Cond{}
+		for _, column := range unique {
+			cond[column+" ="] = record[column]
+		}
+
+		var existing struct {
+			ID int `db:"id"`
+		}
+
+		err := collection.Find(cond).One(&existing)
+		if err == nil {
+			refs[fixture.Table+"."+key] = existing.ID
+			continue
+		}
+
+		if err != up.ErrNoMoreRows {
+			return fmt.Errorf("%s.%s: %w", fixture.Table, key, err)
+		}
+
+		res, err := collection.Insert(record)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", fixture.Table, key, err)
+		}
+
+		refs[fixture.Table+"."+key] = getInsertID(res.ID())
+	}
+
+	return nil
+}
+
+// resolveFixtureValue replaces references to other records with their ids, and json numbers with go numbers
+func resolveFixtureValue(value interface{}, refs FixtureRefs) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, "@") {
+			return v, nil
+		}
+
+		id, ok := refs[strings.TrimPrefix(v, "@")]
+		if !ok {
+			return nil, fmt.Errorf("reference to unknown record %s", v)
+		}
+
+		return id, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+
+		return v.Float64()
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+
+	return value, nil
+}
+
+// readFixtures reads the fixtures from a yaml or json file
+func readFixtures(path string) ([]Fixture, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []Fixture
+
+	switch filepath.Ext(path) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&fixtures)
+	case ".yml", ".yaml":
+		err = yaml.UnmarshalStrict(content, &fixtures)
+	default:
+		return nil, fmt.Errorf("%s: fixtures must be yaml or json files", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return fixtures, nil
+}
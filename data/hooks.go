@@ -0,0 +1,124 @@
+package data
+
+import (
+	db2 "github.com/upper/db/v4"
+)
+
+// BeforeCreator is implemented by models that need to run logic before they are inserted
+type BeforeCreator interface {
+	BeforeCreate(tx Models) error
+}
+
+// AfterCreator is implemented by models that need to run logic after they are inserted
+type AfterCreator interface {
+	AfterCreate(tx Models) error
+}
+
+// BeforeUpdater is implemented by models that need to run logic before they are updated
+type BeforeUpdater interface {
+	BeforeUpdate(tx Models) error
+}
+
+// AfterUpdater is implemented by models that need to run logic after they are updated
+type AfterUpdater interface {
+	AfterUpdate(tx Models) error
+}
+
+// BeforeDeleter is implemented by models that need to run logic before they are deleted.
+// Only the primary key of the record is guaranteed to be set when the hook runs.
+type BeforeDeleter interface {
+	BeforeDelete(tx Models) error
+}
+
+// AfterDeleter is implemented by models that need to run logic after they are deleted.
+// Only the primary key of the record is guaranteed to be set when the hook runs.
+type AfterDeleter interface {
+	AfterDelete(tx Models) error
+}
+
+type hookEvent int
+
+const (
+	hookCreate hookEvent = iota
+	hookUpdate
+	hookDelete
+)
+
+// hooksFor returns the before and after hooks record implements for event, nil for the ones it does not
+func hooksFor(event hookEvent, record interface{}) (before, after func(tx Models) error) {
+	switch event {
+	case hookCreate:
+		if h, ok := record.(BeforeCreator); ok {
+			before = h.BeforeCreate
+		}
+		if h, ok := record.(AfterCreator); ok {
+			after = h.AfterCreate
+		}
+	case hookUpdate:
+		if h, ok := record.(BeforeUpdater); ok {
+			before = h.BeforeUpdate
+		}
+		if h, ok := record.(AfterUpdater); ok {
+			after = h.AfterUpdate
+		}
+	case hookDelete:
+		if h, ok := record.(BeforeDeleter); ok {
+			before = h.BeforeDelete
+		}
+		if h, ok := record.(AfterDeleter); ok {
+			after = h.AfterDelete
+		}
+	}
+
+	return before, after
+}
+
+// withHooks runs op on sess together with the hooks record implements for event. When
+// there are hooks, they run in the same transaction as op and an error returned from any
+// of them aborts the operation and rolls the transaction back. The change of an Auditable
+// record is recorded in the same transaction too.
+func withHooks(sess db2.Session, event hookEvent, record interface{}, op func(tx Models) error) error {
+	ctx := sess.Context()
+	markWrite(ctx)
+
+	models := Models{}.bind(sess)
+
+	audited, isAudited := record.(Auditable)
+
+	before, after := hooksFor(event, record)
+	if before == nil && after == nil && !isAudited {
+		return op(models)
+	}
+
+	return models.Tx(ctx, func(tx Models) error {
+		var trail *audit
+		if isAudited {
+			var err error
+			if trail, err = startAudit(ctx, tx, event, audited); err != nil {
+				return err
+			}
+		}
+
+		if before != nil {
+			if err := before(tx); err != nil {
+				return err
+			}
+		}
+
+		if err := op(tx); err != nil {
+			return err
+		}
+
+		if trail != nil {
+			if err := trail.finish(tx); err != nil {
+				return err
+			}
+		}
+
+		if after != nil {
+			return after(tx)
+		}
+
+		return nil
+	})
+}
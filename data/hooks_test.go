@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type hookedRecord struct {
+	calls        []string
+	beforeCreate error
+	afterCreate  error
+}
+
+func (h *hookedRecord) BeforeCreate(tx Models) error {
+	h.calls = append(h.calls, "before")
+	return h.beforeCreate
+}
+
+func (h *hookedRecord) AfterCreate(tx Models) error {
+	h.calls = append(h.calls, "after")
+	return h.afterCreate
+}
+
+func TestWithHooks(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	record := &hookedRecord{}
+	err := withHooks(m.session(), hookCreate, record, func(tx Models) error {
+		record.calls = append(record.calls, "op")
+		return nil
+	})
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	if len(record.calls) != 3 || record.calls[0] != "before" || record.calls[1] != "op" || record.calls[2] != "after" {
+		t.Errorf("expected hooks to run around the operation, got %v", record.calls)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithHooks_BeforeHookAborts(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	errAborted := errors.New("aborted")
+
+	record := &hookedRecord{beforeCreate: errAborted}
+	err := withHooks(m.session(), hookCreate, record, func(tx Models) error {
+		t.Error("operation ran after the before hook failed")
+		return nil
+	})
+	if !errors.Is(err, errAborted) {
+		t.Errorf("expected %v, got %v", errAborted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithHooks_AfterHookRollsBack(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	errAborted := errors.New("aborted")
+
+	record := &hookedRecord{afterCreate: errAborted}
+	err := withHooks(m.session(), hookCreate, record, func(tx Models) error {
+		return nil
+	})
+	if !errors.Is(err, errAborted) {
+		t.Errorf("expected %v, got %v", errAborted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithHooks_NoHooks(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	called := false
+	err := withHooks(m.session(), hookUpdate, &hookedRecord{}, func(tx Models) error {
+		called = true
+		return nil
+	})
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	if !called {
+		t.Error("operation did not run")
+	}
+
+	// no transaction is started when the record has no hooks for the event
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithHooks_InTransaction(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := m.Tx(context.Background(), func(tx Models) error {
+		return withHooks(tx.session(), hookCreate, &hookedRecord{}, func(tx Models) error {
+			return nil
+		})
+	})
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
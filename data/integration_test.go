@@ -1,265 +1,1239 @@
 // go:build integration
 
 // run tests with this command: go test . --tags integration -count=1
+// pick the database engine with TEST_DATABASE_TYPE=sqlite|postgres|mariadb|mysql, or run them all with make test_integration
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jimmitjoo/gemquick"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
+	db2 "github.com/upper/db/v4"
+	"github.com/upper/db/v4/adapter/mysql"
+	"github.com/upper/db/v4/adapter/postgresql"
+	"github.com/upper/db/v4/adapter/sqlite"
 )
 
 var (
 	host     = "localhost"
-	user     = "postgres"
+	user     = "gemquick"
 	password = "secret"
 	dbName   = "gemquick_test"
-	port     = "5435"
-	dsn      = "host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC connect_timeout=5"
 )
 
-var dummyUser = User{
-	FirstName: "John",
-	LastName:  "Doe",
-	Email:     "john@doe.com",
-	Active:    1,
-	Password:  "password",
+// testDatabase describes how to start and connect to one of the database engines the
+// integration tests run against, the tables are made by the migrations in ../migrations
+type testDatabase struct {
+	options dockertest.RunOptions
+	driver  string
+	port    string
+	dsn     string
+}
+
+// testDatabases is the test matrix, pick an engine with the TEST_DATABASE_TYPE env var.
+// sqlite is the default and runs on a temporary file, so it does not need docker.
+var testDatabases = map[string]testDatabase{
+	"sqlite": {
+		driver: "sqlite3",
+		dsn:    "file:%s?_foreign_keys=1&_busy_timeout=5000",
+	},
+	"postgres": {
+		options: dockertest.RunOptions{
+			Repository: "postgres",
+			Tag:        "latest",
+			Env: []string{
+				"POSTGRES_DB=" + dbName,
+				"POSTGRES_USER=" + user,
+				"POSTGRES_PASSWORD=" + password,
+			},
+			ExposedPorts: []string{"5432"},
+			PortBindings: map[docker.Port][]docker.PortBinding{
+				"5432": {{HostIP: "0.0.0.0", HostPort: "5435"}},
+			},
+		},
+		driver: "pgx",
+		port:   "5435",
+		dsn:    "host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC connect_timeout=5",
+	},
+	"mariadb": {
+		options: dockertest.RunOptions{
+			Repository: "mariadb",
+			Tag:        "10.6",
+			Env: []string{
+				"MYSQL_ROOT_PASSWORD=" + password,
+				"MYSQL_DATABASE=" + dbName,
+				"MYSQL_USER=" + user,
+				"MYSQL_PASSWORD=" + password,
+			},
+			ExposedPorts: []string{"3306"},
+			PortBindings: map[docker.Port][]docker.PortBinding{
+				"3306": {{HostIP: "0.0.0.0", HostPort: "3307"}},
+			},
+		},
+		driver: "mysql",
+		port:   "3307",
+		dsn:    mysqlDSN,
+	},
+	"mysql": {
+		options: dockertest.RunOptions{
+			Repository: "mysql",
+			Tag:        "8.0",
+			Env: []string{
+				"MYSQL_ROOT_PASSWORD=" + password,
+				"MYSQL_DATABASE=" + dbName,
+				"MYSQL_USER=" + user,
+				"MYSQL_PASSWORD=" + password,
+			},
+			ExposedPorts: []string{"3306"},
+			PortBindings: map[docker.Port][]docker.PortBinding{
+				"3306": {{HostIP: "0.0.0.0", HostPort: "3308"}},
+			},
+		},
+		driver: "mysql",
+		port:   "3308",
+		dsn:    mysqlDSN,
+	},
 }
 
-var models Models
 var testDB *sql.DB
+
+// testDatabasePath is the file of a sqlite test database, newTestModels copies it for every test
+var testDatabasePath string
+
 var resource *dockertest.Resource
 var pool *dockertest.Pool
 
-func TestMain(m *testing.M) {
-	os.Setenv("DATABASE_TYPE", "postgres")
-	os.Setenv("UPPER_DB_LOG", "ERROR")
+func TestMain(m *testing.M) {
+	databaseType := os.Getenv("TEST_DATABASE_TYPE")
+	if databaseType == "" {
+		databaseType = "sqlite"
+	}
+
+	database, ok := testDatabases[databaseType]
+	if !ok {
+		log.Fatalf("Unsupported TEST_DATABASE_TYPE: %s", databaseType)
+	}
+
+	os.Setenv("DATABASE_TYPE", databaseType)
+	os.Setenv("UPPER_DB_LOG", "ERROR")
+
+	var err error
+	if database.options.Repository == "" {
+		err = openFileDatabase(database)
+	} else {
+		err = startDatabaseContainer(database)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = NewMigrator(testDB, "../migrations").Up(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if resource != nil {
+		if err = pool.Purge(resource); err != nil {
+			log.Fatalf("Could not purge resource: %s", err)
+		}
+	}
+
+	os.Exit(code)
+}
+
+// openFileDatabase opens a database that lives in a file in a temporary directory
+func openFileDatabase(database testDatabase) error {
+	dir, err := os.MkdirTemp("", "gemquick_test")
+	if err != nil {
+		return err
+	}
+
+	testDatabasePath = filepath.Join(dir, dbName+".db")
+
+	testDB, err = sql.Open(database.driver, fmt.Sprintf(database.dsn, testDatabasePath))
+	if err != nil {
+		return err
+	}
+
+	return testDB.Ping()
+}
+
+// startDatabaseContainer starts the database in a docker container and waits until it accepts connections
+func startDatabaseContainer(database testDatabase) error {
+	p, err := dockertest.NewPool("")
+	if err != nil {
+		return fmt.Errorf("could not connect to docker: %w", err)
+	}
+
+	pool = p
+
+	resource, err = pool.RunWithOptions(&database.options)
+	if err != nil {
+		return fmt.Errorf("could not start resource: %w", err)
+	}
+
+	if err = pool.Retry(func() error {
+		var err error
+		testDB, err = sql.Open(database.driver, fmt.Sprintf(database.dsn, host, database.port, user, password, dbName))
+		if err != nil {
+			return err
+		}
+		return testDB.Ping()
+	}); err != nil {
+		_ = pool.Purge(resource)
+		resource = nil
+		return fmt.Errorf("could not connect to docker: %w", err)
+	}
+
+	return nil
+}
+
+// newTestModels returns models that only the calling test uses, so tests can run in parallel and
+// in any order. The models are bound to a transaction that is rolled back when the test ends.
+// SQLite locks the whole database while a transaction writes, so for sqlite every test gets a
+// copy of the test database instead.
+func newTestModels(t *testing.T) Models {
+	t.Helper()
+
+	if testDatabasePath != "" {
+		return newCopiedDatabaseModels(t)
+	}
+
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal("error starting test transaction:", err)
+	}
+	t.Cleanup(func() { _ = tx.Rollback() })
+
+	var sess db2.Session
+
+	switch os.Getenv("DATABASE_TYPE") {
+	case "mysql", "mariadb":
+		sess, err = mysql.NewTx(tx)
+	default:
+		sess, err = postgresql.NewTx(tx)
+	}
+
+	if err != nil {
+		t.Fatal("error binding test transaction:", err)
+	}
+
+	return Models{}.bind(sess)
+}
+
+// newCopiedDatabaseModels returns models bound to a copy of the sqlite test database
+func newCopiedDatabaseModels(t *testing.T) Models {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), dbName+".db")
+
+	content, err := os.ReadFile(testDatabasePath)
+	if err != nil {
+		t.Fatal("error reading test database:", err)
+	}
+
+	err = os.WriteFile(path, content, 0600)
+	if err != nil {
+		t.Fatal("error copying test database:", err)
+	}
+
+	copied, err := sql.Open(testDatabases["sqlite"].driver, fmt.Sprintf(testDatabases["sqlite"].dsn, path))
+	if err != nil {
+		t.Fatal("error opening test database:", err)
+	}
+	t.Cleanup(func() { _ = copied.Close() })
+
+	sess, err := sqlite.New(copied)
+	if err != nil {
+		t.Fatal("error opening test database:", err)
+	}
+
+	return Models{}.bind(sess)
+}
+
+// mysqlDSN is used for both mysql and mariadb, with the options of the app's dsn, multiStatements lets the
+// migrations with more than one statement run
+const mysqlDSN = "%s:%s@tcp(%s:%s)/%s?collation=utf8mb4_unicode_ci&timeout=5s&parseTime=true&tls=false&readTimeout=5s&multiStatements=true"
+
+// createUser creates a user with the user factory of m, the overrides are applied to it before it is saved
+func createUser(t *testing.T, m Models, overrides ...func(u *User)) *User {
+	t.Helper()
+
+	user, err := m.UserFactory().Create(overrides...)
+	if err != nil {
+		t.Fatal("error creating user:", err)
+	}
+
+	return user
+}
+
+// createToken creates a token for user with the token factory of m, in the given states
+func createToken(t *testing.T, m Models, user *User, states ...string) *Token {
+	t.Helper()
+
+	factory := m.TokenFactory().For(user)
+	for _, state := range states {
+		factory = factory.State(state)
+	}
+
+	token, err := factory.Create()
+	if err != nil {
+		t.Fatal("error creating token:", err)
+	}
+
+	return token
+}
+
+func TestUserFactory(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	built := m.UserFactory().State("inactive").Build(func(u *User) {
+		u.FirstName = "Override"
+	})
+
+	if built.ID != 0 {
+		t.Error("built user was saved")
+	}
+
+	if built.Active != 0 {
+		t.Errorf("expected an inactive user, got user_active %d", built.Active)
+	}
+
+	if built.FirstName != "Override" {
+		t.Errorf("expected %s, got %s", "Override", built.FirstName)
+	}
+
+	other := m.UserFactory().Build()
+	if other.Email == built.Email {
+		t.Error("factory built two users with the same email", other.Email)
+	}
+
+	user := createUser(t, m)
+	if user.ID == 0 {
+		t.Errorf("expected id > 0, got %d", user.ID)
+	}
+
+	matches, err := user.PasswordMatches(FactoryPassword)
+	if err != nil || !matches {
+		t.Error("created user does not have the factory password", err)
+	}
+}
+
+func TestTokenFactory(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	token, err := m.TokenFactory().Create()
+	if err != nil {
+		t.Fatal("error creating token:", err)
+	}
+
+	if token.ID == 0 || token.UserID == 0 {
+		t.Errorf("expected a saved token for a new user, got id %d for user %d", token.ID, token.UserID)
+	}
+
+	expired, err := m.TokenFactory().State("expired").Build()
+	if err != nil {
+		t.Fatal("error building token:", err)
+	}
+	if expired.ExpiresAt.After(time.Now()) {
+		t.Error("expected an expired token, got one expiring at", expired.ExpiresAt)
+	}
+}
+
+func TestUser_Table(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	s := m.Users.Table()
+	if s != "users" {
+		t.Errorf("expected %s, got %s", "users", s)
+	}
+}
+
+func TestUser_Insert(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user, err := m.Users.Create(m.UserFactory().Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID == 0 {
+		t.Errorf("expected id > 0, got %d", user.ID)
+	}
+}
+
+func TestUser_Get(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	created := createUser(t, m)
+
+	user, err := m.Users.Find(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Email != created.Email {
+		t.Errorf("expected %s, got %s", created.Email, user.Email)
+	}
+}
+
+func TestUser_All(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	createUser(t, m)
+
+	users, err := m.Users.All()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(users) == 0 {
+		t.Errorf("expected len(users) > 0, got %d", len(users))
+	}
+}
+
+func TestUser_ByEmail(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	created := createUser(t, m)
+
+	user, err := m.Users.ByEmail(created.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != created.ID {
+		t.Errorf("expected id %d, got %d", created.ID, user.ID)
+	}
+}
+
+func TestUser_Update(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	created := createUser(t, m)
+
+	user, err := m.Users.Find(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := m.UserFactory().Build().Email
+
+	user.FirstName = "Jane"
+	user.LastName = "Doe"
+	user.Email = email
+
+	_, err = m.Users.Update(*user)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	user, err = m.Users.Find(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.FirstName != "Jane" {
+		t.Errorf("expected %s, got %s", "Jane", user.FirstName)
+	}
+
+	if user.LastName != "Doe" {
+		t.Errorf("expected %s, got %s", "Doe", user.LastName)
+	}
+
+	if user.Email != email {
+		t.Errorf("expected %s, got %s", email, user.Email)
+	}
+}
+
+func TestUser_UpdateInRolledBackTx(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	created := createUser(t, m)
+
+	errRollback := errors.New("rolled back")
+
+	err := m.Tx(context.Background(), func(tx Models) error {
+		user, err := tx.Users.Find(created.ID)
+		if err != nil {
+			return err
+		}
+
+		// the fetched user saves itself, in the transaction it was read in
+		user.FirstName = "Rolled"
+		_, err = user.Update(*user)
+		if err != nil {
+			return err
+		}
+
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected %v, got %v", errRollback, err)
+	}
+
+	user, err := m.Users.Find(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.FirstName != created.FirstName {
+		t.Errorf("expected the update to be rolled back to %s, got %s", created.FirstName, user.FirstName)
+	}
+}
+
+func TestUser_UpdateStale(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	staleUser := *user
+
+	user.FirstName = "First"
+	updated, err := m.Users.Update(*user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Version != user.Version+1 {
+		t.Errorf("expected version %d, got %d", user.Version+1, updated.Version)
+	}
+
+	staleUser.FirstName = "Second"
+	_, err = m.Users.Update(staleUser)
+	if !errors.Is(err, ErrStaleRecord) {
+		t.Errorf("expected %v, got %v", ErrStaleRecord, err)
+	}
+
+	current, err := m.Users.Find(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.FirstName != "First" {
+		t.Errorf("expected %s, got %s", "First", current.FirstName)
+	}
+
+	_, err = m.Users.Update(User{ID: 999999})
+	if errors.Is(err, ErrStaleRecord) || err == nil {
+		t.Errorf("expected a missing user to not be reported as stale, got %v", err)
+	}
+}
+
+func TestModels_ValidateUnique(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	other := m.UserFactory().Build(func(u *User) { u.Email = user.Email })
+
+	validator := &gemquick.Validation{Errors: make(map[string]string)}
+	m.Validate(validator, &other)
+
+	if validator.Errors["email"] != "Email is already taken" {
+		t.Error("duplicate email was not reported:", validator.Errors)
+	}
+
+	validator = &gemquick.Validation{Errors: make(map[string]string)}
+	m.Validate(validator, user)
+
+	if !validator.Valid() {
+		t.Error("user can not keep its own email:", validator.Errors)
+	}
+}
+
+func TestModels_ValidateExists(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	var form struct {
+		UserID int `json:"user_id" validate:"exists=users:id"`
+	}
+
+	form.UserID = user.ID
+
+	validator := &gemquick.Validation{Errors: make(map[string]string)}
+	m.Validate(validator, &form)
+
+	if !validator.Valid() {
+		t.Error("existing user was reported missing:", validator.Errors)
+	}
+
+	form.UserID = user.ID + 1000
+
+	validator = &gemquick.Validation{Errors: make(map[string]string)}
+	m.Validate(validator, &form)
+
+	if validator.Errors["user_id"] != "User id does not exist" {
+		t.Error("missing user was not reported:", validator.Errors)
+	}
+}
+
+func TestModels_ValidateQueryError(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	var form struct {
+		Email string `json:"email" validate:"unique=no_such_table:email"`
+	}
+
+	form.Email = "ada@example.com"
+
+	validator := &gemquick.Validation{Errors: make(map[string]string)}
+	err := m.Validate(validator, &form)
+
+	// a query that fails is not a field that is not valid
+	if err == nil {
+		t.Error("expected the error of the query")
+	}
+
+	if !validator.Valid() {
+		t.Error("the failed query was reported as a field error:", validator.Errors)
+	}
+}
+
+func TestUser_CreatePublishesEvent(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	var events []OutboxEvent
+	err := m.session().Collection("outbox").Find(db2.Cond{"topic": "user.created"}).All(&events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 user.created event, got %d", len(events))
+	}
+
+	var published User
+	err = events[0].Decode(&published)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published.ID != user.ID || published.Email != user.Email {
+		t.Errorf("expected user %d %s in the event, got %d %s", user.ID, user.Email, published.ID, published.Email)
+	}
+
+	if published.Password != "" {
+		t.Error("password was published")
+	}
+}
+
+func TestModels_PublishRollback(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	_ = m.Tx(context.Background(), func(tx Models) error {
+		err := tx.Publish("test.rollback", map[string]int{"id": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return errors.New("rolled back")
+	})
+
+	count, err := m.session().Collection("outbox").Find(db2.Cond{"topic": "test.rollback"}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 {
+		t.Error("event of a rolled back transaction was stored")
+	}
+}
+
+// handleOutbox registers handler for topic until the test ends
+func handleOutbox(t *testing.T, topic string, handler OutboxHandler) {
+	HandleOutbox(topic, handler)
+
+	t.Cleanup(func() {
+		outboxHandlersMu.Lock()
+		delete(outboxHandlers, topic)
+		outboxHandlersMu.Unlock()
+	})
+}
+
+func TestOutboxRelay(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	var received []OutboxEvent
+	fail := true
+
+	handleOutbox(t, "test.relay", func(ctx context.Context, event OutboxEvent) error {
+		received = append(received, event)
+
+		if fail {
+			fail = false
+			return errors.New("handler is down")
+		}
+
+		return nil
+	})
+
+	err := m.Publish("test.relay", map[string]string{"hello": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay := m.OutboxRelay()
+	relay.ErrorLog = log.New(io.Discard, "", 0)
+	relay.Backoff = func(attempt int) time.Duration { return -time.Second }
+
+	delivered, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered != 0 || len(received) != 1 {
+		t.Fatalf("expected a failed delivery, got %d delivered and %d received", delivered, len(received))
+	}
+
+	delivered, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered != 1 || len(received) != 2 {
+		t.Fatalf("expected the event to be delivered again, got %d delivered and %d received", delivered, len(received))
+	}
+
+	if received[0].EventID != received[1].EventID {
+		t.Error("redelivered event got a new event id")
+	}
+
+	var payload map[string]string
+	_ = received[1].Decode(&payload)
+	if payload["hello"] != "world" {
+		t.Error("wrong payload", received[1].Payload)
+	}
+
+	var event OutboxEvent
+	err = m.session().Collection("outbox").Find(db2.Cond{"event_id": received[0].EventID}).One(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.DeliveredAt == nil || event.Attempts != 2 || event.LastError != "handler is down" {
+		t.Errorf("wrong outbox row after delivery: %+v", event)
+	}
+
+	delivered, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered != 0 || len(received) != 2 {
+		t.Error("delivered event was delivered again")
+	}
+}
+
+func TestOutboxRelay_LongError(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	handleOutbox(t, "test.long_error", func(ctx context.Context, event OutboxEvent) error {
+		return errors.New(strings.Repeat("x", maxLastErrorLength+100))
+	})
+
+	err := m.Publish("test.long_error", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay := m.OutboxRelay()
+	relay.ErrorLog = log.New(io.Discard, "", 0)
+
+	_, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event OutboxEvent
+	err = m.session().Collection("outbox").Find(db2.Cond{"topic": "test.long_error"}).One(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the error has to fit the last_error column of the migration
+	if len(event.LastError) != maxLastErrorLength {
+		t.Errorf("expected the error cut off after %d characters, got %d", maxLastErrorLength, len(event.LastError))
+	}
+}
+
+func TestModels_Reencrypt(t *testing.T) {
+	if os.Getenv("DATABASE_TYPE") == "mysql" || os.Getenv("DATABASE_TYPE") == "mariadb" {
+		t.Skip("mysql commits the test transaction when a table is created")
+	}
+
+	m := newTestModels(t)
+
+	_, err := m.session().SQL().Exec("CREATE TABLE secrets (id integer PRIMARY KEY, phone text NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := useTestKeyring(t, "one", map[string][]byte{"one": testKeyOne})
+
+	for id, phone := range []EncryptedString{"", "0701234567", "0707654321"} {
+		_, err = m.session().SQL().InsertInto("secrets").Values(id, phone).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestKeyring(t, "two", map[string][]byte{"one": testKeyOne, "two": testKeyTwo})
+
+	changed, err := m.Reencrypt("secrets", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed != 2 {
+		t.Errorf("expected 2 re-encrypted values, got %d", changed)
+	}
+
+	var rows []struct {
+		ID    int             `db:"id"`
+		Phone EncryptedString `db:"phone"`
+	}
+	err = m.session().SQL().SelectFrom("secrets").OrderBy("id").All(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 || rows[1].Phone != "0701234567" || rows[2].Phone != "0707654321" {
+		t.Errorf("wrong values after re-encryption: %+v", rows)
+	}
+
+	var raw []struct {
+		Phone string `db:"phone"`
+	}
+	err = m.session().SQL().Select("phone").From("secrets").Where("id > 0").All(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range raw {
+		if _, err := old.Decrypt(row.Phone); err == nil {
+			t.Error("value is still encrypted with the old key")
+		}
+	}
+
+	changed, _ = m.Reencrypt("secrets", "phone")
+	if changed != 0 {
+		t.Error("values encrypted with the current key were re-encrypted")
+	}
+}
+
+func TestUser_Role(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	admin := createUser(t, m, func(u *User) { u.Role = RoleAdmin })
+	user := createUser(t, m)
+
+	found, err := m.Users.Find(admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !found.IsAdmin() {
+		t.Errorf("expected the admin role, got %q", found.Role)
+	}
+
+	found, err = m.Users.Find(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.IsAdmin() {
+		t.Error("a new user is an admin")
+	}
+}
+
+func TestUser_Phone(t *testing.T) {
+	useTestKeyring(t, "one", map[string][]byte{"one": testKeyOne})
+
+	m := newTestModels(t)
+
+	user := createUser(t, m, func(u *User) { u.Phone = "070-123 45 67" })
+
+	var raw struct {
+		Phone      string `db:"phone"`
+		PhoneIndex string `db:"phone_index"`
+	}
+	err := m.session().SQL().Select("phone", "phone_index").From("users").Where("id = ?", user.ID).One(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(raw.Phone, "123") || raw.PhoneIndex == "" {
+		t.Errorf("phone is not encrypted and indexed: %+v", raw)
+	}
+
+	found, err := m.Users.ByPhone("0701234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != user.ID || found.Phone != "070-123 45 67" {
+		t.Errorf("expected user %d with the decrypted phone, got %d %q", user.ID, found.ID, found.Phone)
+	}
+
+	found.Phone = "0707654321"
+	_, err = m.Users.Update(*found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Users.ByPhone("0701234567")
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("the old phone number still finds the user:", err)
+	}
+
+	found, err = m.Users.ByPhone("070 765 43 21")
+	if err != nil || found.ID != user.ID {
+		t.Error("the new phone number does not find the user:", err)
+	}
+}
+
+func TestUser_History(t *testing.T) {
+	t.Parallel()
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+	firstName := user.FirstName
+
+	ctx := WithAuditContext(m.session().Context(), 42, "req-1")
+	audited := m.WithContext(ctx)
+
+	user.FirstName = "Changed"
+	user.Password = "new hash"
+	_, err := audited.Users.Update(*user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = audited.Users.Delete(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := m.History(user.Table(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(changes))
+	}
+
+	for i, action := range []string{"create", "update", "delete"} {
+		if changes[i].Action != action {
+			t.Errorf("expected change %d to be a %s, got %s", i, action, changes[i].Action)
+		}
+	}
+
+	if changes[0].ActorID != 0 || changes[1].ActorID != 42 || changes[1].RequestID != "req-1" {
+		t.Errorf("changes are attributed wrong: %+v", changes)
+	}
+
+	want := []FieldChange{
+		{Field: "first_name", Old: firstName, New: "Changed"},
+		{Field: "password", Old: redacted, New: redacted},
+	}
+	if !reflect.DeepEqual(changes[1].Diff, want) {
+		t.Errorf("wrong diff of the update: %+v", changes[1].Diff)
+	}
+
+	for _, change := range changes[0].Diff {
+		if change.Field == "version" || change.Field == "created_at" {
+			t.Errorf("%s is not audited, but was recorded", change.Field)
+		}
+		if change.Field == "password" && change.New != redacted {
+			t.Error("password was recorded:", change.New)
+		}
+	}
+
+	for _, change := range changes[2].Diff {
+		if change.New != "" {
+			t.Errorf("deleted %s has a new value %q", change.Field, change.New)
+		}
+	}
+}
+
+func TestModels_Columns(t *testing.T) {
+	t.Parallel()
+	m := newTestModels(t)
+
+	columns, err := m.Columns("outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(columns) != 9 || columns[0].Name != "id" || columns[8].Name != "created_at" {
+		t.Fatalf("wrong columns: %+v", columns)
+	}
+
+	for _, c := range columns {
+		if c.PrimaryKey != (c.Name == "id") {
+			t.Errorf("%s: primary key is %v", c.Name, c.PrimaryKey)
+		}
+
+		if c.Nullable != (c.Name == "delivered_at") {
+			t.Errorf("%s: nullable is %v", c.Name, c.Nullable)
+		}
+	}
+
+	_, err = m.Columns("missing_table")
+	if err == nil {
+		t.Error("expected an error for a missing table")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	if testDatabasePath == "" {
+		t.Skip("the migrator drops tables, it is only tested on a database of its own with sqlite")
+	}
+	t.Parallel()
 
-	p, err := dockertest.NewPool("")
+	pool, err := sql.Open("sqlite3", fmt.Sprintf(testDatabases["sqlite"].dsn, filepath.Join(t.TempDir(), "migrations.db")))
 	if err != nil {
-		log.Fatalf("Could not connect to docker: %s", err)
+		t.Fatal(err)
 	}
+	t.Cleanup(func() { _ = pool.Close() })
 
-	pool = p
+	ctx := context.Background()
+	m := NewMigrator(pool, "../migrations")
 
-	options := dockertest.RunOptions{
-		Repository: "postgres",
-		Tag:        "latest",
-		Env: []string{
-			"POSTGRES_DB=" + dbName,
-			"POSTGRES_USER=" + user,
-			"POSTGRES_PASSWORD=" + password,
-		},
-		ExposedPorts: []string{"5432"},
-		PortBindings: map[docker.Port][]docker.PortBinding{
-			"5432": {{HostIP: "0.0.0.0", HostPort: port}},
-		},
+	migrations, err := m.Migrations()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	resource, err = pool.RunWithOptions(&options)
+	// status only reads, it works before the version table exists
+	pending, err := m.Status(ctx)
 	if err != nil {
-		_ = pool.Purge(resource)
-		log.Fatalf("Could not start resource: %s", err)
+		t.Fatal(err)
 	}
 
-	if err = pool.Retry(func() error {
-		var err error
-		testDB, err = sql.Open("pgx", fmt.Sprintf(dsn, host, port, user, password, dbName))
-		if err != nil {
-			return err
-		}
-		return testDB.Ping()
-	}); err != nil {
-		_ = pool.Purge(resource)
-		log.Fatalf("Could not connect to docker: %s", err)
+	if len(pending) != len(migrations) || pending[0].Applied {
+		t.Errorf("expected %d pending migrations: %+v", len(migrations), pending)
 	}
 
-	err = createTables(testDB)
+	ran, err := m.Up(ctx)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 
-	models = New(testDB)
+	if len(ran) != len(migrations) {
+		t.Fatalf("expected %d migrations to run, %d did", len(migrations), len(ran))
+	}
 
-	code := m.Run()
+	ran, _ = m.Up(ctx)
+	if len(ran) != 0 {
+		t.Error("migrations ran twice")
+	}
 
-	if err = pool.Purge(resource); err != nil {
-		log.Fatalf("Could not purge resource: %s", err)
+	_, err = pool.Exec("INSERT INTO users (first_name, last_name, email, password) VALUES ('a', 'b', 'c', 'd')")
+	if err != nil {
+		t.Fatal("users table was not migrated:", err)
 	}
 
-	os.Exit(code)
-}
+	// roll back to before the outbox table
+	outbox := 0
+	for i, migration := range migrations {
+		if migration.Name == "create_outbox_table" {
+			outbox = i
+		}
+	}
+	steps := len(migrations) - outbox
 
-func createTables(db *sql.DB) error {
-	stmt := `
-	CREATE OR REPLACE FUNCTION trigger_set_timestamp()
-	RETURNS TRIGGER AS $$
-	BEGIN
-	  NEW.updated_at = NOW();
-	RETURN NEW;
-	END;
-	$$ LANGUAGE plpgsql;
-	
-	drop table if exists users cascade;
-	
-	CREATE TABLE users (
-		id SERIAL PRIMARY KEY,
-		first_name character varying(255) NOT NULL,
-		last_name character varying(255) NOT NULL,
-		user_active integer NOT NULL DEFAULT 0,
-		email character varying(255) NOT NULL UNIQUE,
-		password character varying(60) NOT NULL,
-		created_at timestamp without time zone NOT NULL DEFAULT now(),
-		updated_at timestamp without time zone NOT NULL DEFAULT now()
-	);
-	
-	CREATE TRIGGER set_timestamp
-		BEFORE UPDATE ON users
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_timestamp();
-	
-	drop table if exists remember_tokens;
-	
-	CREATE TABLE remember_tokens (
-		id SERIAL PRIMARY KEY,
-		user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
-		remember_token character varying(100) NOT NULL,
-		created_at timestamp without time zone NOT NULL DEFAULT now(),
-		updated_at timestamp without time zone NOT NULL DEFAULT now()
-	);
-	
-	CREATE TRIGGER set_timestamp
-		BEFORE UPDATE ON remember_tokens
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_timestamp();
-	
-	drop table if exists tokens;
-	
-	CREATE TABLE tokens (
-		id SERIAL PRIMARY KEY,
-		user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
-		first_name character varying(255) NOT NULL,
-		email character varying(255) NOT NULL,
-		token character varying(255) NOT NULL,
-		token_hash bytea NOT NULL,
-		created_at timestamp without time zone NOT NULL DEFAULT now(),
-		updated_at timestamp without time zone NOT NULL DEFAULT now(),
-		expiry timestamp without time zone NOT NULL
-	);
-	
-	CREATE TRIGGER set_timestamp
-		BEFORE UPDATE ON tokens
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_timestamp();	
-	`
-
-	_, err := db.Exec(stmt)
-
-	return err
-}
+	ran, err = m.Down(ctx, steps)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-func TestUser_Table(t *testing.T) {
-	s := models.Users.Table()
-	if s != "users" {
-		t.Errorf("expected %s, got %s", "users", s)
+	if len(ran) != steps || ran[0].Version != migrations[len(migrations)-1].Version {
+		t.Errorf("wrong migrations rolled back: %+v", ran)
 	}
-}
 
-func TestUser_Insert(t *testing.T) {
-	user, err := models.Users.Create(dummyUser)
+	statuses, err := m.Status(ctx)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	if user.ID == 0 {
-		t.Errorf("expected id > 0, got %d", user.ID)
+	for i, status := range statuses {
+		if status.Applied != (i < outbox) {
+			t.Errorf("%d_%s: applied is %v", status.Version, status.Name, status.Applied)
+		}
 	}
-}
 
-func TestUser_Get(t *testing.T) {
-	user, err := models.Users.Find(1)
+	// a migration that fails halfway leaves the database dirty until a version is forced
+	_, err = pool.Exec("DROP TABLE model_changes")
+	if err == nil {
+		t.Fatal("model_changes was not rolled back")
+	}
+	_, err = pool.Exec("CREATE TABLE outbox (id integer)")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	if user.ID == 0 {
-		t.Errorf("expected id > 0, got %d", user.ID)
+	_, err = m.Up(ctx)
+	if err == nil {
+		t.Fatal("expected the outbox migration to fail")
 	}
-}
 
-func TestUser_All(t *testing.T) {
-	users, err := models.Users.All()
+	_, err = m.Up(ctx)
+	if !errors.Is(err, ErrMigrationDirty) {
+		t.Fatal("expected ErrMigrationDirty, got", err)
+	}
+
+	err = m.Force(ctx, migrations[outbox-1].Version)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	if len(users) == 0 {
-		t.Errorf("expected len(users) > 0, got %d", len(users))
+	err = m.Force(ctx, 12345)
+	if err == nil {
+		t.Error("expected an error forcing a version without a migration")
 	}
-}
 
-func TestUser_ByEmail(t *testing.T) {
-	user, err := models.Users.ByEmail("john@doe.com")
+	ran, err = m.Fresh(ctx)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	if user.ID == 0 {
-		t.Errorf("expected id > 0, got %d", user.ID)
+	if len(ran) != len(migrations) {
+		t.Errorf("expected fresh to run %d migrations, %d did", len(migrations), len(ran))
+	}
+
+	var users int
+	err = pool.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	if err != nil || users != 0 {
+		t.Error("users were not dropped by fresh:", users, err)
 	}
 }
 
-func TestUser_Update(t *testing.T) {
-	user, err := models.Users.Find(1)
+func TestSessionStore(t *testing.T) {
+	if testDatabasePath == "" {
+		t.Skip("the session store is tested on a migrated database of its own with sqlite")
+	}
+	t.Parallel()
+
+	pool, err := sql.Open("sqlite3", fmt.Sprintf(testDatabases["sqlite"].dsn, filepath.Join(t.TempDir(), "sessions.db")))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
+	t.Cleanup(func() { _ = pool.Close() })
 
-	user.FirstName = "Jane"
-	user.LastName = "Doe"
-	user.Email = "jane@doe.com"
+	_, err = NewMigrator(pool, "../migrations").Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_, err = user.Update(*user)
+	store := NewSessionStore("sqlite", pool)
 
+	err = store.Commit("current", []byte("data"), time.Now().Add(time.Hour))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-
-	user, err = models.Users.Find(1)
+	err = store.Commit("expired", []byte("old"), time.Now().Add(-time.Hour))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	if user.FirstName != "Jane" {
-		t.Errorf("expected %s, got %s", "Jane", user.FirstName)
+	b, found, err := store.Find("current")
+	if err != nil || !found || string(b) != "data" {
+		t.Errorf("expected the current session, got %q, %v, %v", b, found, err)
 	}
 
-	if user.LastName != "Doe" {
-		t.Errorf("expected %s, got %s", "Doe", user.LastName)
+	if _, found, _ = store.Find("expired"); found {
+		t.Error("found an expired session")
 	}
 
-	if user.Email != "jane@doe.com" {
-		t.Errorf("expected %s, got %s", "jane@doe.com", user.Email)
+	err = store.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestUser_PasswordMatches(t *testing.T) {
-	user, err := models.Users.Find(1)
+	err = store.Delete("current")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	matches, err := user.PasswordMatches("password")
+	var count int
+	_ = pool.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected no sessions left, got %d", count)
+	}
+}
+
+func TestUser_PasswordMatches(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	matches, err := user.PasswordMatches(FactoryPassword)
 	if err != nil {
 		t.Error("error checking password match", err)
 	}
@@ -279,95 +1253,181 @@ func TestUser_PasswordMatches(t *testing.T) {
 }
 
 func TestUser_ResetPassword(t *testing.T) {
-	err := models.Users.ResetPassword(1, "newpassword")
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	err := m.Users.ResetPassword(user.ID, "newpassword")
 	if err != nil {
 		t.Error("error resetting password", err)
 	}
 
-	err = models.Users.ResetPassword(2, "newpassword")
+	user, err = m.Users.Find(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, _ := user.PasswordMatches("newpassword")
+	if !matches {
+		t.Error("password was not reset")
+	}
+
+	err = m.Users.ResetPassword(999999, "newpassword")
 	if err == nil {
 		t.Error("did not get an error when resetting a password for a non existent user", err)
 	}
 }
 
 func TestUser_Delete(t *testing.T) {
-	user, err := models.Users.Find(1)
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	err := m.Users.Delete(user.ID)
 	if err != nil {
 		t.Error(err)
 	}
 
-	err = user.Delete(user.ID)
+	_, err = m.Users.Find(user.ID)
+	if err == nil {
+		t.Error("deleted user was found")
+	}
+}
+
+func TestUser_DeleteRevokesTokens(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	if user.Password == FactoryPassword {
+		t.Error("password was not hashed before the user was created")
+	}
+
+	createToken(t, m, user)
+
+	err := m.Users.Delete(user.ID)
 	if err != nil {
-		t.Error(err)
+		t.Fatal("error deleting user", err)
+	}
+
+	tokens, err := m.Tokens.GetTokensForUser(user.ID)
+	if err != nil {
+		t.Error("error getting tokens for user", err)
+	}
+
+	if len(tokens) != 0 {
+		t.Errorf("expected the tokens of a deleted user to be revoked, got %d", len(tokens))
 	}
 }
 
 func TestToken_Table(t *testing.T) {
-	s := models.Tokens.Table()
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	s := m.Tokens.Table()
 	if s != "tokens" {
 		t.Errorf("expected %s, got %s", "tokens", s)
 	}
 }
 
 func TestToken_GenerateToken(t *testing.T) {
-	user, err := models.Users.Create(dummyUser)
-	if err != nil {
-		t.Error(err)
-	}
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
 
-	_, err = models.Tokens.GenerateToken(user.ID, time.Hour*24*365)
+	_, err := m.Tokens.GenerateToken(user.ID, time.Hour*24*365)
 	if err != nil {
 		t.Error("error generating token", err)
 	}
 }
 
 func TestToken_Insert(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+
+	token, err := m.Tokens.GenerateToken(user.ID, time.Hour*24*365)
 	if err != nil {
-		t.Error(err)
+		t.Fatal("error generating token", err)
 	}
 
-	token, err := models.Tokens.GenerateToken(user.ID, time.Hour*24*365)
+	err = m.Tokens.Insert(*token, *user)
 	if err != nil {
-		t.Error("error generating token", err)
+		t.Error("error creating token", err)
+	}
+}
+
+func TestToken_InsertKeepsTokensWhenItFails(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+	createToken(t, m, user)
+
+	// a token without a hash breaks the not null constraint of token_hash
+	err := m.Tokens.Insert(Token{UserID: user.ID, PlainText: "nohash", ExpiresAt: time.Now().Add(time.Hour)}, *user)
+	if err == nil {
+		t.Fatal("expected an error inserting a token without a hash")
 	}
 
-	err = models.Tokens.Insert(*token, *user)
+	tokens, err := m.Tokens.GetTokensForUser(user.ID)
 	if err != nil {
-		t.Error("error creating token", err)
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 1 {
+		t.Errorf("expected the user to keep 1 token, got %d", len(tokens))
 	}
 }
 
 func TestToken_GetUserForToken(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
 	token := "abc"
-	_, err := models.Tokens.GetUserForToken(token)
+	_, err := m.Tokens.GetUserForToken(token)
 	if err == nil {
 		t.Error("expected an error, got nil")
 	}
 
-	user, err := models.Users.ByEmail(dummyUser.Email)
-	if err != nil {
-		t.Error(err)
-	}
+	user := createUser(t, m)
+	theToken := createToken(t, m, user)
 
-	_, err = models.Tokens.GetUserForToken(user.Token.PlainText)
+	found, err := m.Tokens.GetUserForToken(theToken.PlainText)
 	if err != nil {
 		t.Error("error getting user for token", err)
+	} else if found.ID != user.ID {
+		t.Errorf("expected user %d, got %d", user.ID, found.ID)
 	}
 
-	_, err = models.Tokens.GetUserForToken("wrongtoken")
+	_, err = m.Tokens.GetUserForToken("wrongtoken")
 	if err == nil {
 		t.Error("expected an error, got nil")
 	}
 }
 
 func TestToken_GetTokensForUser(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
-	if err != nil {
-		t.Error(err)
-	}
+	t.Parallel()
 
-	tokens, err := models.Tokens.GetTokensForUser(user.ID)
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+	createToken(t, m, user)
+
+	tokens, err := m.Tokens.GetTokensForUser(user.ID)
 	if err != nil {
 		t.Error("error getting tokens for user", err)
 	}
@@ -378,29 +1438,31 @@ func TestToken_GetTokensForUser(t *testing.T) {
 }
 
 func TestToken_GetByToken(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
-	if err != nil {
-		t.Error(err)
-	}
+	t.Parallel()
+
+	m := newTestModels(t)
 
-	_, err = models.Tokens.GetByToken(user.Token.PlainText)
+	token := createToken(t, m, createUser(t, m))
+
+	_, err := m.Tokens.GetByToken(token.PlainText)
 	if err != nil {
 		t.Error("error getting token by token", err)
 	}
 
-	_, err = models.Tokens.GetByToken("wrongtoken")
+	_, err = m.Tokens.GetByToken("wrongtoken")
 	if err == nil {
 		t.Error("expected an error when looking for a non existent token, but got nil")
 	}
 }
 
 func TestToken_Get(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
-	if err != nil {
-		t.Error(err)
-	}
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	token := createToken(t, m, createUser(t, m))
 
-	_, err = models.Tokens.Find(user.Token.ID)
+	_, err := m.Tokens.Find(token.ID)
 	if err != nil {
 		t.Error("error finding token", err)
 	}
@@ -410,33 +1472,31 @@ func TestToken_Get(t *testing.T) {
 var authData = []struct {
 	name          string
 	token         string
-	email         string
+	validUser     bool
 	errorExpected bool
 	message       string
 }{
-	{"invalid", "abcdefghijklmnopqrstuvwxyz", "not@existing.com", true, "invalid token accepted as valid"},
-	{"invalid_length", "abcdefghijklmnopqrstuvwxy", "non@existing.com", true, "invalid token length accepted as valid"},
-	{"no_user", "abcdefghijklmnopqrstuvwxyz", "non@existing.com", true, "token accepted for non existing user"},
-	{"valid", "abcdefghijklmnopqrstuvwxyz", dummyUser.Email, false, "valid token reported as invalid"},
+	{"invalid", "abcdefghijklmnopqrstuvwxyz", false, true, "invalid token accepted as valid"},
+	{"invalid_length", "abcdefghijklmnopqrstuvwxy", false, true, "invalid token length accepted as valid"},
+	{"no_user", "abcdefghijklmnopqrstuvwxyz", false, true, "token accepted for non existing user"},
+	{"valid", "", true, false, "valid token reported as invalid"},
 }
 
 func TestToken_AuthenticateToken(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
 	for _, data := range authData {
-		token := ""
-		if data.email == dummyUser.Email {
-			user, err := models.Users.ByEmail(data.email)
-			if err != nil {
-				t.Error("failed to get user: ", err)
-			}
-			token = user.Token.PlainText
-		} else {
-			token = data.token
+		token := data.token
+		if data.validUser {
+			token = createToken(t, m, createUser(t, m)).PlainText
 		}
 
 		req, _ := http.NewRequest("GET", "/", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
 
-		_, err := models.Tokens.AuthenticateToken(req)
+		_, err := m.Tokens.AuthenticateToken(req)
 		if err == nil && data.errorExpected {
 			t.Errorf("%s: %s", data.name, data.message)
 		} else if err != nil && !data.errorExpected {
@@ -448,53 +1508,52 @@ func TestToken_AuthenticateToken(t *testing.T) {
 }
 
 func TestToken_Delete(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	user := createUser(t, m)
+	token := createToken(t, m, user)
+
+	err := m.Tokens.Delete(token.ID)
 	if err != nil {
-		t.Error(err)
+		t.Error("error deleting token", err)
 	}
 
-	// Get first user token
-	tokens, err := models.Tokens.GetTokensForUser(user.ID)
+	tokens, err := m.Tokens.GetTokensForUser(user.ID)
 	if err != nil {
 		t.Error("error getting tokens for user", err)
 	}
 
-	err = models.Tokens.Delete(tokens[0].ID)
-	if err != nil {
-		t.Error("error deleting token", err)
+	if len(tokens) != 0 {
+		t.Errorf("expected no tokens, got %d", len(tokens))
 	}
 }
 
 func TestToken_ExpiredToken(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
-	if err != nil {
-		t.Error(err)
-	}
+	t.Parallel()
 
-	// Get first user token
-	tokens, err := models.Tokens.GenerateToken(user.ID, -time.Hour)
-	if err != nil {
-		t.Error("error getting tokens for user", err)
-	}
+	m := newTestModels(t)
 
-	err = models.Tokens.Insert(*tokens, *user)
-	if err != nil {
-		t.Error("error creating token", err)
-	}
+	token := createToken(t, m, createUser(t, m), "expired")
 
 	req, _ := http.NewRequest("GET", "/", nil)
-	req.Header.Set("Authorization", "Bearer "+tokens.PlainText)
+	req.Header.Set("Authorization", "Bearer "+token.PlainText)
 
-	_, err = models.Tokens.AuthenticateToken(req)
+	_, err := m.Tokens.AuthenticateToken(req)
 	if err == nil {
 		t.Error("expired token accepted as valid")
 	}
 }
 
 func TestToken_BadHeader(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
 	req, _ := http.NewRequest("GET", "/", nil)
 
-	_, err := models.Tokens.AuthenticateToken(req)
+	_, err := m.Tokens.AuthenticateToken(req)
 	if err == nil {
 		t.Error("missing header accepted as valid")
 	}
@@ -502,35 +1561,15 @@ func TestToken_BadHeader(t *testing.T) {
 	req, _ = http.NewRequest("GET", "/", nil)
 	req.Header.Set("Authorization", "abc")
 
-	_, err = models.Tokens.AuthenticateToken(req)
+	_, err = m.Tokens.AuthenticateToken(req)
 	if err == nil {
 		t.Error("invalid header accepted as valid")
 	}
 
-	newUser := User{
-		Email:     "jimmie@developer.com",
-		Password:  "password",
-		FirstName: "Jimmie",
-		LastName:  "Developer",
-		Active:    1,
-	}
-
-	user, err := models.Users.Create(newUser)
-	if err != nil {
-		t.Error(err)
-	}
-
-	token, err := models.Tokens.GenerateToken(user.ID, 1*time.Hour)
-	if err != nil {
-		t.Error("error generating token", err)
-	}
-
-	err = models.Tokens.Insert(*token, *user)
-	if err != nil {
-		t.Error("error creating token", err)
-	}
+	user := createUser(t, m)
+	token := createToken(t, m, user)
 
-	err = models.Users.Delete(user.ID)
+	err = m.Users.Delete(user.ID)
 	if err != nil {
 		t.Error("error deleting user", err)
 	}
@@ -538,68 +1577,172 @@ func TestToken_BadHeader(t *testing.T) {
 	req, _ = http.NewRequest("GET", "/", nil)
 	req.Header.Set("Authorization", "Bearer "+token.PlainText)
 
-	_, err = models.Tokens.AuthenticateToken(req)
+	_, err = m.Tokens.AuthenticateToken(req)
 	if err == nil {
 		t.Error("deleted user token accepted as valid")
 	}
 }
 
 func TestToken_DeleteNonExistentToken(t *testing.T) {
-	err := models.Tokens.DeleteByToken("avc")
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	err := m.Tokens.DeleteByToken("avc")
 	if err != nil {
 		t.Error("error deleting token")
 	}
 
-	err = models.Tokens.Delete(999999)
+	err = m.Tokens.Delete(999999)
 	if err != nil {
 		t.Error("error deleting token")
 	}
 }
 
 func TestToken_ValidToken(t *testing.T) {
-	user, err := models.Users.ByEmail(dummyUser.Email)
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	token := createToken(t, m, createUser(t, m))
+
+	okay, err := m.Tokens.ValidateToken(token.PlainText)
 	if err != nil {
-		t.Error(err)
+		t.Error("error validating token", err)
+	}
+
+	if !okay {
+		t.Error("valid token reported as not valid")
+	}
+
+	okay, _ = m.Tokens.ValidateToken("abc")
+	if okay {
+		t.Error("invalid token reported as valid")
 	}
 
-	// Generate token for user
-	token, err := models.Tokens.GenerateToken(user.ID, 1*time.Hour)
+	err = m.Tokens.Delete(token.ID)
 	if err != nil {
-		t.Error("error generating token", err)
+		t.Error("error deleting token", err)
+	}
+
+	okay, _ = m.Tokens.ValidateToken(token.PlainText)
+
+	if okay {
+		t.Error("deleted token reported as valid")
+	}
+}
+
+func TestModels_Seed(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	FixturesPath = "fixtures"
+
+	err := m.Seed(context.Background(), false, "tokens")
+	if err == nil {
+		t.Fatal("expected the development seeders to be refused outside development")
+	}
+
+	for i := 0; i < 2; i++ {
+		err := m.Seed(context.Background(), true, "tokens")
+		if err != nil {
+			t.Fatal("error seeding", err)
+		}
 	}
 
-	err = models.Tokens.Insert(*token, *user)
+	user, err := m.Users.ByEmail("admin@example.com")
 	if err != nil {
-		t.Error("error creating token", err)
+		t.Fatal(err)
+	}
+
+	matches, err := user.PasswordMatches("password")
+	if err != nil || !matches {
+		t.Error("seeded user does not have the expected password", err)
 	}
 
-	okay, err := models.Tokens.ValidateToken(token.PlainText)
+	tokens, err := m.Tokens.GetTokensForUser(user.ID)
 	if err != nil {
-		t.Error("error validating token", err)
+		t.Fatal(err)
 	}
 
-	if !okay {
-		t.Error("valid token reported as not valid")
+	if len(tokens) != 1 {
+		t.Errorf("expected 1 token after seeding twice, got %d", len(tokens))
 	}
+}
 
-	okay, _ = models.Tokens.ValidateToken("abc")
-	if okay {
-		t.Error("invalid token reported as valid")
+func TestModels_LoadFixtures(t *testing.T) {
+	t.Parallel()
+
+	m := newTestModels(t)
+
+	dir := t.TempDir()
+
+	usersFile := filepath.Join(dir, "users.yml")
+	err := os.WriteFile(usersFile, []byte(`
+- table: users
+  unique: [email]
+  records:
+    fixture:
+      first_name: Fixture
+      last_name: User
+      email: fixture@user.com
+      password: not-a-hash
+      user_active: 1
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokensFile := filepath.Join(dir, "tokens.json")
+	err = os.WriteFile(tokensFile, []byte(`[
+	{
+		"table": "tokens",
+		"unique": ["token"],
+		"records": {
+			"fixture_token": {
+				"user_id": "@users.fixture",
+				"first_name": "Fixture",
+				"email": "fixture@user.com",
+				"token": "FIXTURETOKENFIXTURETOKEN12",
+				"token_hash": "hash",
+				"expiry": "2099-01-01 00:00:00"
+			}
+		}
+	}
+]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs FixtureRefs
+	for i := 0; i < 2; i++ {
+		refs, err = m.LoadFixtures(usersFile, tokensFile)
+		if err != nil {
+			t.Fatal("error loading fixtures", err)
+		}
 	}
 
-	user, err = models.Users.ByEmail(dummyUser.Email)
+	user, err := m.Users.ByEmail("fixture@user.com")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+
+	if refs["users.fixture"] != user.ID {
+		t.Errorf("expected users.fixture to reference %d, got %d", user.ID, refs["users.fixture"])
 	}
 
-	err = models.Tokens.Delete(user.Token.ID)
+	tokens, err := m.Tokens.GetTokensForUser(user.ID)
 	if err != nil {
-		t.Error("error deleting token", err)
+		t.Fatal(err)
 	}
 
-	okay, _ = models.Tokens.ValidateToken(user.Token.PlainText)
+	if len(tokens) != 1 {
+		t.Errorf("expected 1 token after loading the fixtures twice, got %d", len(tokens))
+	}
 
-	if okay {
-		t.Error("deleted token reported as valid")
+	_, err = m.LoadFixtures(filepath.Join(dir, "missing.yml"))
+	if err == nil {
+		t.Error("expected an error for a missing fixture file, got nil")
 	}
 }
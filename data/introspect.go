@@ -0,0 +1,95 @@
+package data
+
+import (
+	"fmt"
+	"os"
+)
+
+// Column describes a column of a database table, as the database reports it
+type Column struct {
+	Name string
+	// DataType is the type of the column in the database, e.g. "character varying" or "int"
+	DataType   string
+	Nullable   bool
+	PrimaryKey bool
+}
+
+// columnQueries read the columns of a table in the order they were created, by DATABASE_TYPE
+var columnQueries = map[string]string{
+	"postgres": `
+		SELECT c.column_name, c.data_type, c.is_nullable = 'YES',
+			EXISTS (
+				SELECT 1
+				FROM information_schema.table_constraints tc
+				JOIN information_schema.key_column_usage k
+					ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema
+				WHERE tc.constraint_type = 'PRIMARY KEY'
+					AND tc.table_schema = c.table_schema
+					AND tc.table_name = c.table_name
+					AND k.column_name = c.column_name
+			)
+		FROM information_schema.columns c
+		WHERE c.table_schema = current_schema() AND c.table_name = ?
+		ORDER BY c.ordinal_position`,
+	"mysql": `
+		SELECT column_name, data_type, is_nullable = 'YES', column_key = 'PRI'
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ?
+		ORDER BY ordinal_position`,
+	// sqlite reports INTEGER PRIMARY KEY columns as nullable, though they never are
+	"sqlite": `
+		SELECT name, type, "notnull" = 0 AND pk = 0, pk > 0
+		FROM pragma_table_info(?)
+		ORDER BY cid`,
+}
+
+// Columns returns the columns of table, in the order they were created
+func (m Models) Columns(table string) ([]Column, error) {
+	query, ok := columnQueries[databaseType()]
+	if !ok {
+		return nil, fmt.Errorf("reading columns is not supported for database type %q", os.Getenv("DATABASE_TYPE"))
+	}
+
+	rows, err := m.session().SQL().Query(query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []Column
+
+	for rows.Next() {
+		var c Column
+
+		err := rows.Scan(&c.Name, &c.DataType, &c.Nullable, &c.PrimaryKey)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist or has no columns", table)
+	}
+
+	return columns, nil
+}
+
+// databaseType returns DATABASE_TYPE without its aliases, "postgres", "mysql" or "sqlite"
+func databaseType() string {
+	switch os.Getenv("DATABASE_TYPE") {
+	case "postgres", "postgresql":
+		return "postgres"
+	case "mysql", "mariadb":
+		return "mysql"
+	case "sqlite", "sqlite3":
+		return "sqlite"
+	}
+
+	return os.Getenv("DATABASE_TYPE")
+}
@@ -0,0 +1,560 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockID is the advisory lock migrations hold, so that only one instance migrates at a time
+const migrationLockID = 72731637
+
+// migrationFileRegex matches the golang-migrate style names of migration files, e.g.
+// 1678016213679607_create_auth_tables.up.sql or 1678016213679607_create_auth_tables.mysql.up.sql
+var migrationFileRegex = regexp.MustCompile(`^([0-9]+)_(.+?)(?:\.(postgres|mysql|sqlite))?\.(up|down)\.sql$`)
+
+// ErrMigrationDirty is returned when a migration failed halfway, the schema has to be fixed by
+// hand and the version set with Force before migrating again
+var ErrMigrationDirty = errors.New("data: a migration failed halfway, fix the schema and force a version")
+
+// Migration is a version of the schema and the files that migrate to and from it
+type Migration struct {
+	Version int64
+	Name    string
+	// Up and Down are the paths of the files, Down is empty when the migration can not be rolled back
+	Up   string
+	Down string
+}
+
+// MigrationStatus is a migration and whether the database is migrated to it
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	// Dirty is true when the migration failed halfway
+	Dirty bool
+}
+
+// Migrator runs the migrations in a directory. Every version can have a file per database
+// type, e.g. .mysql.up.sql, and a file without a type that is used for the other databases.
+// The version the database is at is kept in the schema_migrations table, like golang-migrate
+// does, so databases migrated with either of them can be migrated with the other.
+//
+// MySQL only runs files with more than one statement when the DSN has multiStatements=true.
+type Migrator struct {
+	// Dir is the directory with the migration files
+	Dir string
+	// LockTimeout is how long to wait for another instance to finish migrating
+	LockTimeout time.Duration
+
+	pool    *sql.DB
+	dialect string
+}
+
+// NewMigrator returns a migrator for the migrations in dir, for the database in DATABASE_TYPE
+func NewMigrator(pool *sql.DB, dir string) *Migrator {
+	return &Migrator{
+		Dir:         dir,
+		LockTimeout: time.Minute,
+		pool:        pool,
+		dialect:     databaseType(),
+	}
+}
+
+// Migrations returns the migrations in Dir for the database, oldest first
+func (m *Migrator) Migrations() ([]Migration, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files for the database win over the ones without a type
+	byVersion := make(map[int64]*Migration)
+	specific := make(map[string]bool)
+	// every version, also the ones that only have files for other databases
+	names := make(map[int64]string)
+
+	for _, entry := range entries {
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		names[version] = match[2]
+
+		dialect, direction := match[3], match[4]
+		if dialect != "" && dialect != m.dialect {
+			continue
+		}
+
+		key := match[1] + "." + direction
+		if dialect == "" && specific[key] {
+			continue
+		} else if dialect != "" {
+			specific[key] = true
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+
+		path := filepath.Join(m.Dir, entry.Name())
+		if direction == "up" {
+			migration.Up = path
+		} else {
+			migration.Down = path
+		}
+	}
+
+	var migrations []Migration
+
+	for version, name := range names {
+		migration, ok := byVersion[version]
+		if !ok || migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file for %s", version, name, m.dialect)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up runs the migrations newer than the version of the database, and returns the ones it ran
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var ran []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		ran, err = m.up(ctx, conn)
+		return err
+	})
+
+	return ran, err
+}
+
+// Down rolls back the n newest migrations the database is migrated to, and returns them
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n < 1 {
+		return nil, errors.New("data: roll back at least one migration")
+	}
+
+	var ran []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		migrations, err := m.Migrations()
+		if err != nil {
+			return err
+		}
+
+		version, err := m.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var applied []Migration
+		for _, migration := range migrations {
+			if migration.Version <= version {
+				applied = append(applied, migration)
+			}
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(ran) < n; i-- {
+			migration := applied[i]
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+
+			var previous int64
+			if i > 0 {
+				previous = applied[i-1].Version
+			}
+
+			err := m.run(ctx, conn, migration.Down, previous)
+			if err != nil {
+				return fmt.Errorf("rolling back %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			ran = append(ran, migration)
+		}
+
+		return nil
+	})
+
+	return ran, err
+}
+
+// Status returns every migration and whether the database is migrated to it. It only reads,
+// so it does not wait for the migration lock, while another instance migrates the migration
+// it is running shows as dirty.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := m.pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var version int64
+	var dirty bool
+
+	exists, err := m.versionTableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		version, dirty, err = m.version(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+
+	for _, migration := range migrations {
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   migration.Version <= version,
+			Dirty:     dirty && migration.Version == version,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Force sets the version of the database without running any migration, and clears the dirty
+// flag. Use it after fixing the schema by hand when a migration failed halfway. Version 0
+// means that no migration has run.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 {
+		migrations, err := m.Migrations()
+		if err != nil {
+			return err
+		}
+
+		i := sort.Search(len(migrations), func(i int) bool { return migrations[i].Version >= version })
+		if i == len(migrations) || migrations[i].Version != version {
+			return fmt.Errorf("data: there is no migration %d", version)
+		}
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// Fresh drops every table in the database and runs all the migrations. It deletes all the
+// data, so it is only meant for development databases.
+func (m *Migrator) Fresh(ctx context.Context) ([]Migration, error) {
+	var ran []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		err := m.dropTables(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		err = m.createVersionTable(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		ran, err = m.up(ctx, conn)
+		return err
+	})
+
+	return ran, err
+}
+
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := m.cleanVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		err := m.run(ctx, conn, migration.Up, migration.Version)
+		if err != nil {
+			return ran, fmt.Errorf("migrating %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		ran = append(ran, migration)
+	}
+
+	return ran, nil
+}
+
+// run runs the statements in the file at path, the database is at version when they succeed.
+// The version is marked dirty while they run, so that a failure halfway is noticed.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, path string, version int64) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = m.setVersion(ctx, conn, version, true)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(string(content)) != "" {
+		_, err = conn.ExecContext(ctx, string(content))
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.setVersion(ctx, conn, version, false)
+}
+
+// withLock runs fn on a connection that holds the migration lock, and has the schema_migrations table
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = m.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("data: taking the migration lock: %w", err)
+	}
+	defer m.unlock(conn)
+
+	err = m.createVersionTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// lock takes an advisory lock, sqlite has none and the database file is locked by every write anyway
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	lockCtx, cancel := context.WithTimeout(ctx, m.LockTimeout)
+	defer cancel()
+
+	switch m.dialect {
+	case "postgres":
+		_, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", migrationLockID)
+		return err
+	case "mysql":
+		var locked sql.NullInt64
+
+		err := conn.QueryRowContext(lockCtx, "SELECT GET_LOCK(?, ?)", strconv.Itoa(migrationLockID), int(m.LockTimeout.Seconds())).Scan(&locked)
+		if err != nil {
+			return err
+		}
+
+		if locked.Int64 != 1 {
+			return fmt.Errorf("another instance has been migrating for more than %s", m.LockTimeout)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) {
+	switch m.dialect {
+	case "postgres":
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	case "mysql":
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", strconv.Itoa(migrationLockID))
+	}
+}
+
+func (m *Migrator) createVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)")
+	return err
+}
+
+// versionTableExists reports whether the version table has been created, by the first migration command
+func (m *Migrator) versionTableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var query string
+
+	switch m.dialect {
+	case "postgres":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'"
+	case "mysql":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'"
+	case "sqlite":
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	default:
+		return false, fmt.Errorf("data: migrations are not supported for database type %q", m.dialect)
+	}
+
+	var count int
+
+	err := conn.QueryRowContext(ctx, query).Scan(&count)
+
+	return count > 0, err
+}
+
+// version returns the version of the database, 0 when no migration has run
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+// cleanVersion returns the version of the database, and ErrMigrationDirty when it is dirty
+func (m *Migrator) cleanVersion(ctx context.Context, conn *sql.Conn) (int64, error) {
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, fmt.Errorf("%w (at version %d)", ErrMigrationDirty, version)
+	}
+
+	return version, nil
+}
+
+func (m *Migrator) setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+
+	if version > 0 {
+		_, err = tx.ExecContext(ctx, m.placeholders("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)"), version, dirty)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// dropTables drops every table in the database, or in the current schema for postgres
+func (m *Migrator) dropTables(ctx context.Context, conn *sql.Conn) error {
+	var query, drop string
+
+	switch m.dialect {
+	case "postgres":
+		query = "SELECT tablename FROM pg_tables WHERE schemaname = current_schema()"
+		drop = `DROP TABLE IF EXISTS "%s" CASCADE`
+	case "mysql":
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'"
+		drop = "DROP TABLE IF EXISTS `%s`"
+	case "sqlite":
+		query = "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'"
+		drop = `DROP TABLE IF EXISTS "%s"`
+	default:
+		return fmt.Errorf("data: dropping tables is not supported for database type %q", m.dialect)
+	}
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// the tables are dropped in any order, so foreign keys must not stop them
+	switch m.dialect {
+	case "mysql":
+		_, err = conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0")
+		defer conn.ExecContext(context.Background(), "SET FOREIGN_KEY_CHECKS = 1")
+	case "sqlite":
+		_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(drop, table))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placeholders replaces the ? placeholders in query with the numbered ones postgres uses
+func (m *Migrator) placeholders(query string) string {
+	if m.dialect != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
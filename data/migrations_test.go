@@ -0,0 +1,91 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeMigrations creates the named, empty, migration files in a temporary directory
+func writeMigrations(t *testing.T, names ...string) string {
+	dir := t.TempDir()
+
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestMigrator_Migrations(t *testing.T) {
+	dir := writeMigrations(t,
+		"2_create_sessions.mysql.up.sql",
+		"2_create_sessions.postgres.up.sql",
+		"2_create_sessions.postgres.down.sql",
+		"1_create_users.up.sql",
+		"1_create_users.down.sql",
+		"1_create_users.mysql.up.sql",
+		"3_add_index.up.sql",
+		"README.md",
+	)
+
+	var tests = []struct {
+		dialect   string
+		versions  []int64
+		usersUp   string
+		usersDown string
+	}{
+		{"mysql", []int64{1, 2, 3}, "1_create_users.mysql.up.sql", "1_create_users.down.sql"},
+		{"postgres", []int64{1, 2, 3}, "1_create_users.up.sql", "1_create_users.down.sql"},
+	}
+
+	for _, e := range tests {
+		m := &Migrator{Dir: dir, dialect: e.dialect}
+
+		migrations, err := m.Migrations()
+		if err != nil {
+			t.Fatalf("%s: %v", e.dialect, err)
+		}
+
+		if len(migrations) != len(e.versions) {
+			t.Fatalf("%s: expected %d migrations, got %+v", e.dialect, len(e.versions), migrations)
+		}
+
+		for i, migration := range migrations {
+			if migration.Version != e.versions[i] {
+				t.Errorf("%s: expected migration %d to be version %d, got %d", e.dialect, i, e.versions[i], migration.Version)
+			}
+		}
+
+		if filepath.Base(migrations[0].Up) != e.usersUp || filepath.Base(migrations[0].Down) != e.usersDown {
+			t.Errorf("%s: wrong files for create_users: %+v", e.dialect, migrations[0])
+		}
+
+		if migrations[0].Name != "create_users" {
+			t.Errorf("%s: wrong name %s", e.dialect, migrations[0].Name)
+		}
+	}
+
+	// there is no file for sqlite to create the sessions with
+	m := &Migrator{Dir: dir, dialect: "sqlite"}
+	if _, err := m.Migrations(); err == nil {
+		t.Error("expected an error for a migration without an up file")
+	}
+}
+
+func TestMigrator_Placeholders(t *testing.T) {
+	m := &Migrator{dialect: "postgres"}
+
+	query := m.placeholders("INSERT INTO t (a, b) VALUES (?, ?)")
+	if query != "INSERT INTO t (a, b) VALUES ($1, $2)" {
+		t.Error("wrong query:", query)
+	}
+
+	m.dialect = "mysql"
+	if m.placeholders("?") != "?" {
+		t.Error("placeholders were replaced for mysql")
+	}
+}
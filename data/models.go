@@ -1,41 +1,151 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
+	"sync/atomic"
 
 	db2 "github.com/upper/db/v4"
 	"github.com/upper/db/v4/adapter/mysql"
 	"github.com/upper/db/v4/adapter/postgresql"
+	"github.com/upper/db/v4/adapter/sqlite"
 )
 
 var db *sql.DB
 var upper db2.Session
 
+// ErrNotFound is returned when there is no record with the id that was asked for, it is the
+// error of upper, so that callers do not need to import it to check for it
+var ErrNotFound = db2.ErrNoMoreRows
+
+// savepointID is used to give every nested transaction a unique savepoint name
+var savepointID uint64
+
 type Models struct {
 	// any models inserted here (and in the New functions)
 	// are easily accessible throughout the entire application
 	Users  User
 	Tokens Token
-}
 
-func New(databasePool *sql.DB) Models {
-	db = databasePool
+	// sess is the session the models above are bound to, nil means the global session
+	sess db2.Session
+}
 
-	if os.Getenv("DATABASE_TYPE") == "mysql" || os.Getenv("DATABASE_TYPE") == "mariadb" {
-		// TODO: add mysql/mariadb models here
-		upper, _ = mysql.New(db)
-	} else if os.Getenv("DATABASE_TYPE") == "postgres" || os.Getenv("DATABASE_TYPE") == "postgresql" {
-		upper, _ = postgresql.New(db)
+// New returns the models on databasePool, the database in DATABASE_TYPE. It returns an error
+// when DATABASE_TYPE is not a database the models support.
+func New(databasePool *sql.DB) (Models, error) {
+	sess, err := newSession(databasePool)
+	if err != nil {
+		return Models{}, err
 	}
 
+	db = databasePool
+	upper = sess
+
 	return Models{
 		Users:  User{},
 		Tokens: Token{},
+	}, nil
+}
+
+// newSession returns an upper session on pool, for the database in DATABASE_TYPE
+func newSession(pool *sql.DB) (db2.Session, error) {
+	return newSessionFor(os.Getenv("DATABASE_TYPE"), pool)
+}
+
+// newSessionFor returns an upper session on pool, for a database of dbType
+func newSessionFor(dbType string, pool *sql.DB) (db2.Session, error) {
+	if dbType == "mysql" || dbType == "mariadb" {
+		return mysql.New(pool)
+	} else if dbType == "postgres" || dbType == "postgresql" {
+		return postgresql.New(pool)
+	} else if dbType == "sqlite" || dbType == "sqlite3" {
+		return sqlite.New(pool)
+	}
+
+	return nil, fmt.Errorf("unsupported database type %q", dbType)
+}
+
+// bind returns a copy of the models where every model runs its queries on sess
+func (m Models) bind(sess db2.Session) Models {
+	return Models{
+		Users:  User{sess: sess},
+		Tokens: Token{sess: sess},
+		sess:   sess,
 	}
 }
 
+// session returns the session the models are bound to
+func (m Models) session() db2.Session {
+	return sessionOr(m.sess)
+}
+
+// WithContext returns a copy of the models where every query runs with ctx,
+// so that queries are cancelled together with e.g. the http request
+func (m Models) WithContext(ctx context.Context) Models {
+	return m.bind(m.session().WithContext(ctx))
+}
+
+// Tx runs fn in a database transaction. The models passed to fn are bound to the
+// transaction, and it is committed if fn returns nil and rolled back otherwise.
+// Calling Tx on models that already are in a transaction creates a savepoint, so
+// only the work done in the nested fn is rolled back when it fails. Transactions
+// always run on the primary, also when there are read replicas.
+func (m Models) Tx(ctx context.Context, fn func(tx Models) error) error {
+	sess := m.session().WithContext(ctx)
+	markWrite(ctx)
+
+	if _, ok := sess.Driver().(*sql.Tx); ok {
+		return m.savepoint(sess, fn)
+	}
+
+	return sess.TxContext(ctx, func(tx db2.Session) error {
+		return fn(m.bind(tx))
+	}, nil)
+}
+
+// savepoint runs fn inside a savepoint of the transaction sess belongs to
+func (m Models) savepoint(sess db2.Session, fn func(tx Models) error) (err error) {
+	name := fmt.Sprintf("sp_%d", atomic.AddUint64(&savepointID, 1))
+
+	_, err = sess.SQL().Exec("SAVEPOINT " + name)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = sess.SQL().Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(p)
+		}
+	}()
+
+	err = fn(m.bind(sess))
+	if err != nil {
+		_, rollbackErr := sess.SQL().Exec("ROLLBACK TO SAVEPOINT " + name)
+		if rollbackErr != nil {
+			return fmt.Errorf("%v: %w", rollbackErr, err)
+		}
+
+		return err
+	}
+
+	_, err = sess.SQL().Exec("RELEASE SAVEPOINT " + name)
+
+	return err
+}
+
+// sessionOr returns sess, or the global session when sess is nil
+func sessionOr(sess db2.Session) db2.Session {
+	if sess != nil {
+		return sess
+	}
+
+	return upper
+}
+
 func getInsertID(i db2.ID) int {
 
 	if i == nil {
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"os"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -10,17 +12,38 @@ import (
 )
 
 func TestNew(t *testing.T) {
-	fakeDB, _, _ := sqlmock.New()
+	fakeDB, mock, _ := sqlmock.New()
 	defer fakeDB.Close()
 
-	_ = os.Setenv("DATABASE_TYPE", "mysql")
-	m := New(fakeDB)
+	mock.ExpectQuery("DATABASE()").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("gemquick"))
+
+	// New replaces the package wide session, put back the one the other tests use
+	oldDB, oldUpper := db, upper
+	t.Cleanup(func() { db, upper = oldDB, oldUpper })
+
+	t.Setenv("DATABASE_TYPE", "mysql")
+	m, err := New(fakeDB)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if fmt.Sprintf("%T", m) != "data.Models" {
 		t.Error("Wrong type", fmt.Sprintf("%T", m))
 	}
 }
 
+func TestNew_UnsupportedDatabase(t *testing.T) {
+	fakeDB, _, _ := sqlmock.New()
+	defer fakeDB.Close()
+
+	t.Setenv("DATABASE_TYPE", "oracle")
+	_, err := New(fakeDB)
+	if err == nil {
+		t.Error("no error for an unsupported database type")
+	}
+}
+
 func TestGetInsertID(t *testing.T) {
 	var id db2.ID
 	id = int64(1)
@@ -39,3 +62,120 @@ func TestGetInsertID(t *testing.T) {
 	}
 
 }
+
+func newMockModels(t *testing.T) (Models, sqlmock.Sqlmock) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fakeDB.Close() })
+
+	// New replaces the package wide session, put back the one the other tests use
+	oldDB, oldUpper := db, upper
+	t.Cleanup(func() { db, upper = oldDB, oldUpper })
+
+	mock.ExpectQuery("CURRENT_DATABASE").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("gemquick"))
+
+	t.Setenv("DATABASE_TYPE", "postgres")
+	m, err := New(fakeDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m, mock
+}
+
+func TestModels_Tx(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err := m.Tx(context.Background(), func(tx Models) error {
+		if _, ok := tx.Users.session().Driver().(*sql.Tx); !ok {
+			t.Error("users model is not bound to the transaction")
+		}
+
+		if _, ok := tx.Tokens.session().Driver().(*sql.Tx); !ok {
+			t.Error("tokens model is not bound to the transaction")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestModels_TxRollback(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	errFailed := errors.New("failed")
+
+	err := m.Tx(context.Background(), func(tx Models) error {
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected %v, got %v", errFailed, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestModels_TxSavepoint(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	errFailed := errors.New("failed")
+
+	err := m.Tx(context.Background(), func(tx Models) error {
+		err := tx.Tx(context.Background(), func(nested Models) error {
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			t.Errorf("expected %v, got %v", errFailed, err)
+		}
+
+		return tx.Tx(context.Background(), func(nested Models) error {
+			return nil
+		})
+	})
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestModels_TxCancelledContext(t *testing.T) {
+	m, _ := newMockModels(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := m.Tx(ctx, func(tx Models) error {
+		t.Error("transaction started with a cancelled context")
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
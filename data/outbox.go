@@ -0,0 +1,307 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	db2 "github.com/upper/db/v4"
+)
+
+// OutboxEvent is an event waiting in the outbox table to be delivered to its handlers
+type OutboxEvent struct {
+	ID int `db:"id,omitempty"`
+	// EventID is unique per event, and the same for every delivery of it. Delivery is at least
+	// once, so handlers use it to notice events they have handled already.
+	EventID     string     `db:"event_id"`
+	Topic       string     `db:"topic"`
+	Payload     string     `db:"payload"`
+	Attempts    int        `db:"attempts"`
+	LastError   string     `db:"last_error"`
+	AvailableAt time.Time  `db:"available_at"`
+	DeliveredAt *time.Time `db:"delivered_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
+
+func (e *OutboxEvent) Table() string {
+	return "outbox"
+}
+
+// Decode unmarshals the payload of the event into v
+func (e *OutboxEvent) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(e.Payload), v)
+}
+
+// maxLastErrorLength is the length of the last_error column of mysql, longer errors are cut off
+const maxLastErrorLength = 2048
+
+// OutboxHandler delivers an event, returning an error makes the relay try again later
+type OutboxHandler func(ctx context.Context, event OutboxEvent) error
+
+var (
+	outboxHandlersMu sync.RWMutex
+	outboxHandlers   = make(map[string][]OutboxHandler)
+)
+
+// HandleOutbox makes the relay deliver the events of topic to handler. When a topic has more
+// than one handler and one of them fails, all of them get the event again.
+func HandleOutbox(topic string, handler OutboxHandler) {
+	outboxHandlersMu.Lock()
+	defer outboxHandlersMu.Unlock()
+
+	outboxHandlers[topic] = append(outboxHandlers[topic], handler)
+}
+
+func handlersFor(topic string) []OutboxHandler {
+	outboxHandlersMu.RLock()
+	defer outboxHandlersMu.RUnlock()
+
+	return outboxHandlers[topic]
+}
+
+// handledTopics returns the topics that have handlers
+func handledTopics() []string {
+	outboxHandlersMu.RLock()
+	defer outboxHandlersMu.RUnlock()
+
+	var topics []string
+	for topic := range outboxHandlers {
+		topics = append(topics, topic)
+	}
+
+	return topics
+}
+
+// Publish stores an event with payload, marshalled to json, in the outbox. Publish with the
+// models passed to a Tx function, or to a hook, and the event is only stored if the changes
+// it is about are, and the relay delivers it after the transaction commits.
+func (m Models) Publish(topic string, payload interface{}) error {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	event := OutboxEvent{
+		EventID:     hex.EncodeToString(id),
+		Topic:       topic,
+		Payload:     string(content),
+		AvailableAt: now,
+		CreatedAt:   now,
+	}
+
+	markWrite(m.session().Context())
+
+	_, err = m.session().Collection(event.Table()).Insert(event)
+
+	return err
+}
+
+// OutboxRelay delivers the events in the outbox to their handlers, and tries failed deliveries
+// again with an exponential backoff. Several relays can run against the same database, every
+// event is claimed by one relay at a time.
+type OutboxRelay struct {
+	// BatchSize is how many events are read from the outbox at a time
+	BatchSize int
+	// PollInterval is how long the relay waits when the outbox is empty
+	PollInterval time.Duration
+	// MaxAttempts is how often delivery is tried, after that the event stays in the outbox undelivered
+	MaxAttempts int
+	// Backoff returns how long to wait before delivering an event again after attempt failed
+	Backoff func(attempt int) time.Duration
+	// ClaimTimeout is how long an event stays claimed by a relay, if the relay dies while
+	// delivering it another relay delivers it after this time
+	ClaimTimeout time.Duration
+	// ErrorLog receives the failed deliveries, nil means the standard logger
+	ErrorLog *log.Logger
+
+	models Models
+}
+
+// OutboxRelay returns a relay for the outbox of m
+func (m Models) OutboxRelay() *OutboxRelay {
+	return &OutboxRelay{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		MaxAttempts:  10,
+		Backoff:      OutboxBackoff,
+		ClaimTimeout: time.Minute,
+		models:       m,
+	}
+}
+
+// OutboxBackoff waits 10 seconds after the first failed attempt, and doubles that after every
+// following one, up to an hour
+func OutboxBackoff(attempt int) time.Duration {
+	backoff := 10 * time.Second
+	for i := 1; i < attempt && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+
+	return backoff
+}
+
+// Run delivers events until ctx is done
+func (r *OutboxRelay) Run(ctx context.Context) {
+	for {
+		delivered, err := r.RelayOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.errorLog().Println("error relaying outbox:", err)
+		}
+
+		if delivered > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// RelayOnce delivers the events that are due, up to BatchSize of them, and returns how many
+// of them were delivered. Events of topics without handlers wait until a handler is registered.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	sess := r.models.session().WithContext(ctx)
+
+	topics := handledTopics()
+	if len(topics) == 0 {
+		return 0, nil
+	}
+
+	var events []OutboxEvent
+
+	err := sess.Collection("outbox").Find(db2.Cond{
+		"topic IN":        topics,
+		"delivered_at":    db2.IsNull(),
+		"available_at <=": time.Now(),
+		"attempts <":      r.MaxAttempts,
+	}).OrderBy("id").Limit(r.BatchSize).All(&events)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+
+	for _, event := range events {
+		// stop between events on shutdown, the events that are not claimed yet stay due
+		select {
+		case <-ctx.Done():
+			return delivered, ctx.Err()
+		default:
+		}
+
+		claimed, err := r.claim(sess, &event)
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue
+		}
+
+		deliverErr := r.deliver(ctx, event)
+		if deliverErr != nil {
+			r.errorLog().Printf("error delivering outbox event %s (%s), attempt %d: %v", event.EventID, event.Topic, event.Attempts, deliverErr)
+
+			_, err = sess.SQL().Update("outbox").
+				Set("available_at", time.Now().Add(r.Backoff(event.Attempts)), "last_error", truncate(deliverErr.Error(), maxLastErrorLength)).
+				Where("id = ?", event.ID).
+				Exec()
+			if err != nil {
+				return delivered, err
+			}
+
+			continue
+		}
+
+		_, err = sess.SQL().Update("outbox").
+			Set("delivered_at", time.Now()).
+			Where("id = ?", event.ID).
+			Exec()
+		if err != nil {
+			return delivered, err
+		}
+
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// claim counts the attempt and hides the event from other relays for ClaimTimeout. It
+// reports false when another relay claimed the event first.
+func (r *OutboxRelay) claim(sess db2.Session, event *OutboxEvent) (bool, error) {
+	res, err := sess.SQL().Update("outbox").
+		Set("attempts", event.Attempts+1, "available_at", time.Now().Add(r.ClaimTimeout)).
+		Where("id = ? AND attempts = ? AND delivered_at IS NULL", event.ID, event.Attempts).
+		Exec()
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	event.Attempts++
+
+	return affected == 1, nil
+}
+
+// deliver hands event to every handler of its topic, a panicking handler counts as failed
+func (r *OutboxRelay) deliver(ctx context.Context, event OutboxEvent) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+
+	for _, handler := range handlersFor(event.Topic) {
+		err = handler(ctx, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *OutboxRelay) errorLog() *log.Logger {
+	if r.ErrorLog != nil {
+		return r.ErrorLog
+	}
+
+	return log.Default()
+}
+
+// truncate returns s cut off after max characters
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+
+	return string(runes[:max])
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// firstConnectBackoff is how long ConnectRetry waits after the first failed attempt
+	firstConnectBackoff = 250 * time.Millisecond
+	// maxConnectBackoff is the longest ConnectRetry waits between two attempts
+	maxConnectBackoff = 5 * time.Second
+)
+
+// PoolSettings are the limits of a database connection pool, zero values keep the defaults of database/sql
+type PoolSettings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Apply sets the limits on pool
+func (s PoolSettings) Apply(pool *sql.DB) {
+	if s.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(s.MaxOpenConns)
+	}
+	if s.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(s.MaxIdleConns)
+	}
+	if s.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(s.ConnMaxLifetime)
+	}
+	if s.ConnMaxIdleTime > 0 {
+		pool.SetConnMaxIdleTime(s.ConnMaxIdleTime)
+	}
+}
+
+// ConnectRetry calls connect until it succeeds, so that the app can start before its database
+// accepts connections, e.g. in docker compose. It waits 250ms after the first failure, twice
+// as long after every following one, up to 5s, and returns the last error when ctx is done
+// first. onError, when not nil, is called with every failure.
+func ConnectRetry(ctx context.Context, connect func() error, onError func(attempt int, err error)) error {
+	backoff := firstConnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+
+		if onError != nil {
+			onError(attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+// PoolStats returns the statistics of the connection pools the models use, by name: "primary",
+// "replica <host>" for every read replica and the names of the named connections
+func PoolStats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats)
+
+	if db != nil {
+		stats["primary"] = db.Stats()
+	}
+
+	if r := currentReplicas(); r != nil {
+		for _, replica := range r.replicas {
+			stats["replica "+replica.host] = replica.pool.Stats()
+		}
+	}
+
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	for name, c := range connections {
+		stats[name] = c.pool.Stats()
+	}
+
+	return stats
+}
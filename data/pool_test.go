@@ -0,0 +1,69 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoolSettings_Apply(t *testing.T) {
+	pool, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "pool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	PoolSettings{MaxOpenConns: 7, ConnMaxLifetime: time.Minute}.Apply(pool)
+
+	if pool.Stats().MaxOpenConnections != 7 {
+		t.Error("max open connections were not set:", pool.Stats().MaxOpenConnections)
+	}
+}
+
+func TestConnectRetry(t *testing.T) {
+	attempts := 0
+	var failures []int
+
+	err := ConnectRetry(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, func(attempt int, err error) {
+		failures = append(failures, attempt)
+	})
+
+	if err != nil || attempts != 3 || len(failures) != 2 {
+		t.Errorf("expected success on the third attempt, got %v after %d attempts, failures %v", err, attempts, failures)
+	}
+}
+
+func TestConnectRetry_Deadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	refused := errors.New("connection refused")
+
+	start := time.Now()
+	err := ConnectRetry(ctx, func() error { return refused }, nil)
+
+	if !errors.Is(err, refused) {
+		t.Error("expected the last error, got", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Error("retrying did not stop at the deadline")
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	addTestConnection(t, "analytics")
+
+	if _, ok := PoolStats()["analytics"]; !ok {
+		t.Error("named connection is missing from the pool stats")
+	}
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db2 "github.com/upper/db/v4"
+)
+
+// DefaultSlowQueryThreshold is how long a statement may run before QueryLogger warns about it
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// DefaultRedactedColumns are the columns QueryLogger never logs the values of
+var DefaultRedactedColumns = []string{"password", "token", "token_hash"}
+
+// QueryLogger logs the statements the models run, with their duration and arguments, and
+// counts them in the QueryStats of the context they run with. Install it with EnableQueryLog.
+type QueryLogger struct {
+	// Log receives every statement, nil logs only slow and failed statements
+	Log *log.Logger
+	// Warn receives the statements that were slow or failed, nil means the standard logger
+	Warn *log.Logger
+	// SlowThreshold is how long a statement may run before it is logged to Warn
+	SlowThreshold time.Duration
+	// Redact are the columns whose values are replaced in the logged arguments
+	Redact []string
+}
+
+// EnableQueryLog sends every statement upper runs, on any session, through l
+func EnableQueryLog(l *QueryLogger) {
+	db2.LC().SetLogger(l)
+	db2.LC().SetLevel(db2.LogLevelDebug)
+}
+
+// Print is called by upper for every statement, with a *db2.QueryStatus, and for its other log messages
+func (l *QueryLogger) Print(v ...interface{}) {
+	for _, value := range v {
+		status, ok := value.(*db2.QueryStatus)
+		if !ok {
+			if l.Log != nil {
+				l.Log.Print(value)
+			}
+			continue
+		}
+
+		l.logQuery(status)
+	}
+}
+
+// Printf logs the other messages of upper
+func (l *QueryLogger) Printf(format string, v ...interface{}) {
+	if l.Log != nil {
+		l.Log.Printf(format, v...)
+	}
+}
+
+// Fatal logs the fatal messages of upper, and exits
+func (l *QueryLogger) Fatal(v ...interface{}) {
+	l.warn().Fatal(v...)
+}
+
+// Fatalf logs the fatal messages of upper, and exits
+func (l *QueryLogger) Fatalf(format string, v ...interface{}) {
+	l.warn().Fatalf(format, v...)
+}
+
+// Panic logs the messages upper panics with, and panics
+func (l *QueryLogger) Panic(v ...interface{}) {
+	l.warn().Panic(v...)
+}
+
+// Panicf logs the messages upper panics with, and panics
+func (l *QueryLogger) Panicf(format string, v ...interface{}) {
+	l.warn().Panicf(format, v...)
+}
+
+// warn returns the logger for slow and failed statements
+func (l *QueryLogger) warn() *log.Logger {
+	if l.Warn != nil {
+		return l.Warn
+	}
+
+	return log.Default()
+}
+
+// logQuery logs status, and counts it in the stats of its context
+func (l *QueryLogger) logQuery(status *db2.QueryStatus) {
+	duration := status.End.Sub(status.Start)
+	query := status.Query()
+
+	if status.Context != nil {
+		if stats := QueryStatsFrom(status.Context); stats != nil {
+			stats.add(query, duration)
+		}
+	}
+
+	// upper flags statements slower than its own threshold, the logger has its own
+	err := status.Err
+	if errors.Is(err, db2.ErrWarnSlowQuery) {
+		err = nil
+	}
+
+	threshold := l.SlowThreshold
+	if threshold == 0 {
+		threshold = DefaultSlowQueryThreshold
+	}
+
+	line := fmt.Sprintf("%s %s", duration, query)
+	if len(status.Args) > 0 {
+		line = fmt.Sprintf("%s %v", line, l.redact(query, status.Args))
+	}
+
+	switch {
+	case err != nil:
+		l.warn().Printf("query failed: %s: %v", line, err)
+	case duration >= threshold:
+		l.warn().Printf("slow query: %s", line)
+	case l.Log != nil:
+		l.Log.Printf("query: %s", line)
+	}
+}
+
+var (
+	placeholderRegex    = regexp.MustCompile(`\$\d+|\?`)
+	insertRegex         = regexp.MustCompile(`(?i)^INSERT\s+INTO\s+\S+\s*\(([^)]*)\)\s*VALUES\s*\(`)
+	comparedColumnRegex = regexp.MustCompile(`(?i)["` + "`" + `]?(\w+)["` + "`" + `]?\s*(?:=|<>|!=|<=|>=|<|>|LIKE|IN\s*\()\s*$`)
+)
+
+// redact returns args with the values of the redacted columns replaced. The column of an
+// argument is the one it is compared with or assigned to, or its place in an insert.
+func (l *QueryLogger) redact(query string, args []interface{}) []interface{} {
+	redact := l.Redact
+	if redact == nil {
+		redact = DefaultRedactedColumns
+	}
+	if len(redact) == 0 {
+		return args
+	}
+
+	var insertColumns []string
+	valuesStart := -1
+	if match := insertRegex.FindStringSubmatchIndex(query); match != nil {
+		for _, column := range strings.Split(query[match[2]:match[3]], ",") {
+			insertColumns = append(insertColumns, strings.Trim(strings.TrimSpace(column), "\"`"))
+		}
+		valuesStart = match[1]
+	}
+
+	redacted := append([]interface{}(nil), args...)
+	valueIndex := 0
+
+	for i, loc := range placeholderRegex.FindAllStringIndex(query, -1) {
+		argIndex := i
+		if placeholder := query[loc[0]:loc[1]]; placeholder != "?" {
+			n, _ := strconv.Atoi(placeholder[1:])
+			argIndex = n - 1
+		}
+		if argIndex < 0 || argIndex >= len(redacted) {
+			continue
+		}
+
+		var column string
+		if valuesStart >= 0 && loc[0] >= valuesStart && valueIndex < len(insertColumns) {
+			column = insertColumns[valueIndex]
+			valueIndex++
+		} else if match := comparedColumnRegex.FindStringSubmatch(query[:loc[0]]); match != nil {
+			column = match[1]
+		}
+
+		for _, name := range redact {
+			if strings.EqualFold(column, name) {
+				redacted[argIndex] = "[REDACTED]"
+			}
+		}
+	}
+
+	return redacted
+}
+
+type queryStatsKey struct{}
+
+// QueryStats counts the statements run with a context, e.g. during one http request
+type QueryStats struct {
+	mu       sync.Mutex
+	count    int
+	duration time.Duration
+	queries  map[string]int
+}
+
+// WithQueryStats returns a context that counts the statements run with it, see QueryStatsFrom
+func WithQueryStats(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryStatsKey{}, &QueryStats{queries: make(map[string]int)})
+}
+
+// QueryStatsFrom returns the stats of ctx, or nil when it does not count statements
+func QueryStatsFrom(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return stats
+}
+
+func (s *QueryStats) add(query string, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	s.duration += duration
+	s.queries[query]++
+}
+
+// Count returns the number of statements run
+func (s *QueryStats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count
+}
+
+// Duration returns the time spent running statements
+func (s *QueryStats) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.duration
+}
+
+// Repeated returns the statements that were run at least min times, with how often they
+// were run. A statement that is repeated with only its arguments changing, usually in a
+// loop, is the sign of an N+1 problem.
+func (s *QueryStats) Repeated(min int) map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repeated := make(map[string]int)
+	for query, count := range s.queries {
+		if count >= min {
+			repeated[query] = count
+		}
+	}
+
+	return repeated
+}
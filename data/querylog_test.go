@@ -0,0 +1,125 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	db2 "github.com/upper/db/v4"
+)
+
+func TestQueryLogger_Redact(t *testing.T) {
+	l := &QueryLogger{}
+
+	var tests = []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  []interface{}
+	}{
+		{"postgres insert", `INSERT INTO "users" ("email", "password") VALUES ($1, $2) RETURNING "id"`,
+			[]interface{}{"a@example.com", "secret"}, []interface{}{"a@example.com", "[REDACTED]"}},
+		{"mysql insert", "INSERT INTO `tokens` (`token`, `user_id`) VALUES (?, ?)",
+			[]interface{}{"abc", 1}, []interface{}{"[REDACTED]", 1}},
+		{"update", `UPDATE "users" SET "first_name" = $1, "password" = $2 WHERE ("id" = $3)`,
+			[]interface{}{"Al", "secret", 1}, []interface{}{"Al", "[REDACTED]", 1}},
+		{"where", `SELECT * FROM "tokens" WHERE ("token" = $1 AND "expiry" > $2)`,
+			[]interface{}{"abc", "now"}, []interface{}{"[REDACTED]", "now"}},
+		{"nothing to redact", `SELECT * FROM "users" WHERE ("email" = ?)`,
+			[]interface{}{"a@example.com"}, []interface{}{"a@example.com"}},
+	}
+
+	for _, e := range tests {
+		got := l.redact(e.query, e.args)
+		if fmt.Sprint(got) != fmt.Sprint(e.want) {
+			t.Errorf("%s: expected %v but got %v", e.name, e.want, got)
+		}
+	}
+}
+
+func TestQueryLogger_SlowAndFailed(t *testing.T) {
+	var info, warn bytes.Buffer
+	l := &QueryLogger{
+		Log:           log.New(&info, "", 0),
+		Warn:          log.New(&warn, "", 0),
+		SlowThreshold: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+
+	l.Print(&db2.QueryStatus{RawQuery: "SELECT 1", Start: start, End: start.Add(time.Millisecond)})
+	l.Print(&db2.QueryStatus{RawQuery: "SELECT 2", Start: start, End: start.Add(time.Second), Err: db2.ErrWarnSlowQuery})
+	l.Print(&db2.QueryStatus{RawQuery: "SELECT 3", Start: start, End: start, Err: errors.New("syntax error")})
+
+	if !strings.Contains(info.String(), "query: 1ms SELECT 1") {
+		t.Error("fast query was not logged:", info.String())
+	}
+
+	if !strings.Contains(warn.String(), "slow query: 1s SELECT 2") {
+		t.Error("slow query was not warned about:", warn.String())
+	}
+
+	if !strings.Contains(warn.String(), "query failed: 0s SELECT 3: syntax error") {
+		t.Error("failed query was not warned about:", warn.String())
+	}
+
+	if strings.Contains(info.String(), "SELECT 2") || strings.Contains(info.String(), "SELECT 3") {
+		t.Error("slow and failed queries were logged as normal queries")
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	m, mock := newMockModels(t)
+
+	// nil puts back upper's default logger
+	level := db2.LC().Level()
+	t.Cleanup(func() {
+		db2.LC().SetLogger(nil)
+		db2.LC().SetLevel(level)
+	})
+
+	var info bytes.Buffer
+	EnableQueryLog(&QueryLogger{Log: log.New(&info, "", 0)})
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	ctx := WithQueryStats(context.Background())
+	models := m.WithContext(ctx)
+
+	for id := 1; id <= 3; id++ {
+		_, err := models.session().SQL().Exec("DELETE FROM tokens WHERE user_id = ?", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// statements run without the context are not counted
+	mock.ExpectExec("DELETE FROM").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, _ = m.session().SQL().Exec("DELETE FROM tokens WHERE user_id = ?", 4)
+
+	stats := QueryStatsFrom(ctx)
+
+	if stats.Count() != 3 {
+		t.Error("wrong number of queries counted", stats.Count())
+	}
+
+	if len(stats.Repeated(3)) != 1 {
+		t.Error("repeated query not found", stats.Repeated(3))
+	}
+
+	if len(stats.Repeated(4)) != 0 {
+		t.Error("query repeated too often", stats.Repeated(4))
+	}
+
+	if strings.Count(info.String(), "DELETE FROM") != 4 {
+		t.Error("wrong queries logged:", info.String())
+	}
+}
@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	db2 "github.com/upper/db/v4"
+)
+
+// DefaultStickyWindow is how long reads stay on the primary after a request has written
+const DefaultStickyWindow = 5 * time.Second
+
+// replicas are the read replicas reads are routed to, nil means every query goes to the primary.
+// Requests read it while it is replaced at shutdown, use currentReplicas and UseReadReplicas.
+var (
+	replicasMu sync.RWMutex
+	replicas   *ReadReplicas
+)
+
+// ReadReplicas routes reads to a set of read replicas. Writes and transactions always go to
+// the primary, and so do reads when the primary is forced with UsePrimary, or when the request
+// has written within the sticky window, see WithStickyPrimary.
+type ReadReplicas struct {
+	// StickyWindow is how long reads stay on the primary after a request has written
+	StickyWindow time.Duration
+
+	replicas []*readReplica
+	next     uint64
+}
+
+type readReplica struct {
+	host    string
+	pool    *sql.DB
+	sess    db2.Session
+	healthy int32
+}
+
+// NewReadReplicas returns an empty set of read replicas, add replicas to it with Add
+func NewReadReplicas() *ReadReplicas {
+	return &ReadReplicas{StickyWindow: DefaultStickyWindow}
+}
+
+// Add adds the replica at host, with the connection pool for it, to the rotation
+func (r *ReadReplicas) Add(host string, pool *sql.DB) error {
+	sess, err := newSession(pool)
+	if err != nil {
+		return err
+	}
+
+	r.replicas = append(r.replicas, &readReplica{host: host, pool: pool, sess: sess, healthy: 1})
+
+	return nil
+}
+
+// Healthy returns the hosts of the replicas that currently are in the rotation
+func (r *ReadReplicas) Healthy() []string {
+	var hosts []string
+
+	for _, replica := range r.replicas {
+		if atomic.LoadInt32(&replica.healthy) == 1 {
+			hosts = append(hosts, replica.host)
+		}
+	}
+
+	return hosts
+}
+
+// CheckHealth pings every replica, replicas that fail are taken out of the rotation
+// and replicas that answer again are put back into it
+func (r *ReadReplicas) CheckHealth(ctx context.Context, timeout time.Duration) {
+	for _, replica := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := replica.pool.PingContext(pingCtx)
+		cancel()
+
+		if err != nil {
+			atomic.StoreInt32(&replica.healthy, 0)
+		} else {
+			atomic.StoreInt32(&replica.healthy, 1)
+		}
+	}
+}
+
+// MonitorHealth runs CheckHealth every interval, until ctx is done
+func (r *ReadReplicas) MonitorHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.CheckHealth(ctx, interval)
+			}
+		}
+	}()
+}
+
+// Close closes the connection pools of the replicas
+func (r *ReadReplicas) Close() error {
+	var firstErr error
+
+	for _, replica := range r.replicas {
+		err := replica.pool.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// session returns the session of the next healthy replica, or nil when no replica is healthy
+func (r *ReadReplicas) session() db2.Session {
+	count := len(r.replicas)
+
+	for i := 0; i < count; i++ {
+		replica := r.replicas[int(atomic.AddUint64(&r.next, 1)-1)%count]
+
+		if atomic.LoadInt32(&replica.healthy) == 1 {
+			return replica.sess
+		}
+	}
+
+	return nil
+}
+
+// UseReadReplicas routes the reads of all models to r, nil routes them back to the primary
+func UseReadReplicas(r *ReadReplicas) {
+	replicasMu.Lock()
+	defer replicasMu.Unlock()
+
+	replicas = r
+}
+
+// currentReplicas returns the read replicas reads are routed to, nil when there are none
+func currentReplicas() *ReadReplicas {
+	replicasMu.RLock()
+	defer replicasMu.RUnlock()
+
+	return replicas
+}
+
+type routingKey struct{}
+
+// routing is the state of a request that decides where its reads go
+type routing struct {
+	forcePrimary bool
+	lastWrite    *int64
+}
+
+// WithStickyPrimary returns a context that remembers when it was last used for a write, so
+// that the reads following a write, e.g. in the same http request, see what was written
+func WithStickyPrimary(ctx context.Context) context.Context {
+	state := routingFrom(ctx)
+	state.lastWrite = new(int64)
+
+	return context.WithValue(ctx, routingKey{}, state)
+}
+
+// UsePrimary returns a context that sends every query made with it to the primary
+func UsePrimary(ctx context.Context) context.Context {
+	state := routingFrom(ctx)
+	state.forcePrimary = true
+
+	return context.WithValue(ctx, routingKey{}, state)
+}
+
+// Primary returns a copy of the models where every query goes to the primary
+func (m Models) Primary() Models {
+	return m.WithContext(UsePrimary(m.session().Context()))
+}
+
+func routingFrom(ctx context.Context) routing {
+	state, _ := ctx.Value(routingKey{}).(routing)
+	return state
+}
+
+// markWrite records that ctx was used for a write, see WithStickyPrimary
+func markWrite(ctx context.Context) {
+	state := routingFrom(ctx)
+	if state.lastWrite != nil {
+		atomic.StoreInt64(state.lastWrite, time.Now().UnixNano())
+	}
+}
+
+// readSession returns the session a read should run on. That is a read replica, unless sess
+// is a transaction, the primary is forced or the request wrote within the sticky window.
+func readSession(sess db2.Session) db2.Session {
+	sess = sessionOr(sess)
+
+	r := currentReplicas()
+	if r == nil || sess == nil {
+		return sess
+	}
+
+	if _, ok := sess.Driver().(*sql.Tx); ok {
+		return sess
+	}
+
+	ctx := sess.Context()
+	state := routingFrom(ctx)
+
+	if state.forcePrimary {
+		return sess
+	}
+
+	if state.lastWrite != nil {
+		lastWrite := atomic.LoadInt64(state.lastWrite)
+		if lastWrite != 0 && time.Since(time.Unix(0, lastWrite)) < r.StickyWindow {
+			return sess
+		}
+	}
+
+	replica := r.session()
+	if replica == nil {
+		return sess
+	}
+
+	return replica.WithContext(ctx)
+}
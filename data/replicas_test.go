@@ -0,0 +1,198 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockReplicas routes reads to count mocked replicas, named replica-0, replica-1 and so on
+func newMockReplicas(t *testing.T, count int) (*ReadReplicas, []*sql.DB, []sqlmock.Sqlmock) {
+	r := NewReadReplicas()
+
+	var pools []*sql.DB
+	var mocks []sqlmock.Sqlmock
+
+	for i := 0; i < count; i++ {
+		pool, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = pool.Close() })
+
+		mock.ExpectPing()
+		mock.ExpectQuery("CURRENT_DATABASE").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("gemquick"))
+
+		err = r.Add(fmt.Sprintf("replica-%d", i), pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pools = append(pools, pool)
+		mocks = append(mocks, mock)
+	}
+
+	UseReadReplicas(r)
+	t.Cleanup(func() { UseReadReplicas(nil) })
+
+	return r, pools, mocks
+}
+
+func TestReadSession_RoundRobin(t *testing.T) {
+	m, _ := newMockModels(t)
+	_, pools, _ := newMockReplicas(t, 2)
+
+	first := m.Users.readSession().Driver()
+	second := m.Users.readSession().Driver()
+
+	if first == second {
+		t.Error("reads did not alternate between the replicas")
+	}
+
+	for _, driver := range []interface{}{first, second} {
+		if driver != pools[0] && driver != pools[1] {
+			t.Error("read did not go to a replica")
+		}
+	}
+}
+
+func TestReadSession_WithoutReplicas(t *testing.T) {
+	m, _ := newMockModels(t)
+
+	if m.Users.readSession().Driver() != db {
+		t.Error("read did not go to the primary")
+	}
+}
+
+func TestReadReplicas_CheckHealth(t *testing.T) {
+	m, _ := newMockModels(t)
+	r, pools, mocks := newMockReplicas(t, 2)
+
+	mocks[0].ExpectPing().WillReturnError(errors.New("connection refused"))
+	mocks[1].ExpectPing()
+
+	r.CheckHealth(context.Background(), time.Second)
+
+	if healthy := r.Healthy(); len(healthy) != 1 || healthy[0] != "replica-1" {
+		t.Error("wrong healthy replicas", healthy)
+	}
+
+	for i := 0; i < 3; i++ {
+		if m.Users.readSession().Driver() != pools[1] {
+			t.Error("read went to the failing replica")
+		}
+	}
+
+	mocks[0].ExpectPing().WillReturnError(errors.New("connection refused"))
+	mocks[1].ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	r.CheckHealth(context.Background(), time.Second)
+
+	if m.Users.readSession().Driver() != db {
+		t.Error("read did not fall back to the primary")
+	}
+
+	mocks[0].ExpectPing()
+	mocks[1].ExpectPing()
+
+	r.CheckHealth(context.Background(), time.Second)
+
+	if len(r.Healthy()) != 2 {
+		t.Error("recovered replicas were not put back into the rotation")
+	}
+}
+
+func TestReadSession_UsePrimary(t *testing.T) {
+	m, _ := newMockModels(t)
+	newMockReplicas(t, 1)
+
+	primary := m.Primary()
+	if primary.Users.readSession().Driver() != db {
+		t.Error("read did not go to the forced primary")
+	}
+
+	primary = m.WithContext(UsePrimary(context.Background()))
+	if primary.Tokens.readSession().Driver() != db {
+		t.Error("read did not go to the forced primary")
+	}
+}
+
+func TestReadSession_StickyPrimary(t *testing.T) {
+	m, _ := newMockModels(t)
+	r, pools, _ := newMockReplicas(t, 1)
+
+	ctx := WithStickyPrimary(context.Background())
+	models := m.WithContext(ctx)
+
+	if models.Users.readSession().Driver() != pools[0] {
+		t.Error("read before a write did not go to the replica")
+	}
+
+	markWrite(ctx)
+
+	if models.Users.readSession().Driver() != db {
+		t.Error("read after a write did not go to the primary")
+	}
+
+	if m.Users.readSession().Driver() != pools[0] {
+		t.Error("read of another request did not go to the replica")
+	}
+
+	r.StickyWindow = 0
+
+	if models.Users.readSession().Driver() != pools[0] {
+		t.Error("read after the sticky window did not go to the replica")
+	}
+}
+
+func TestReadSession_Tx(t *testing.T) {
+	m, mock := newMockModels(t)
+	newMockReplicas(t, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err := m.Tx(context.Background(), func(tx Models) error {
+		if _, ok := tx.Users.readSession().Driver().(*sql.Tx); !ok {
+			t.Error("read in a transaction did not go to the transaction")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToken_DeleteSticksToPrimary(t *testing.T) {
+	for name, remove := range map[string]func(tokens Token) error{
+		"Delete":        func(tokens Token) error { return tokens.Delete(1) },
+		"DeleteByToken": func(tokens Token) error { return tokens.DeleteByToken("token") },
+	} {
+		m, mock := newMockModels(t)
+		_, pools, _ := newMockReplicas(t, 1)
+
+		mock.MatchExpectationsInOrder(false)
+		mock.ExpectQuery("").WillReturnRows(sqlmock.NewRows([]string{"pkey"}).AddRow("id"))
+		mock.ExpectExec("DELETE").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ctx := WithStickyPrimary(context.Background())
+		models := m.WithContext(ctx)
+
+		err := remove(models.Tokens)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// a deleted token must not be found on a replica that has not caught up yet
+		if models.Tokens.readSession().Driver() == pools[0] {
+			t.Errorf("%s: read after deleting a token went to the replica", name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Seeder fills the database with data. The seeders named in DependsOn always run before it.
+// Seeders should be safe to run more than once, without adding the same rows again.
+type Seeder struct {
+	Name      string
+	DependsOn []string
+	// Development seeders add data that must never be in production, like users with known
+	// passwords, Seed only runs them when it is told it runs in development
+	Development bool
+	Run         func(tx Models) error
+}
+
+var seeders = make(map[string]Seeder)
+
+// RegisterSeeder makes a seeder available to Seed, registering a name twice replaces the first one
+func RegisterSeeder(s Seeder) {
+	seeders[s.Name] = s
+}
+
+// Seed runs the named seeders, and the seeders they depend on, in a single transaction.
+// When no names are given every registered seeder runs. Unless development is true nothing
+// runs when one of them is a development seeder.
+func (m Models) Seed(ctx context.Context, development bool, names ...string) error {
+	order, err := seedOrder(names...)
+	if err != nil {
+		return err
+	}
+
+	if !development {
+		for _, s := range order {
+			if s.Development {
+				return fmt.Errorf("seeder %s only runs in development or test", s.Name)
+			}
+		}
+	}
+
+	return m.Tx(ctx, func(tx Models) error {
+		for _, s := range order {
+			err := s.Run(tx)
+			if err != nil {
+				return fmt.Errorf("seeder %s: %w", s.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// seedOrder returns the named seeders and their dependencies, with every seeder after the ones it depends on
+func seedOrder(names ...string) ([]Seeder, error) {
+	if len(names) == 0 {
+		for name := range seeders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	var order []Seeder
+	state := make(map[string]int)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("seeders depend on each other: %v", append(path, name))
+		}
+
+		s, ok := seeders[name]
+		if !ok {
+			return fmt.Errorf("no seeder named %s", name)
+		}
+
+		state[name] = visiting
+		for _, dependency := range s.DependsOn {
+			err := visit(dependency, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		order = append(order, s)
+
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"testing"
+)
+
+func withSeeders(t *testing.T, registered ...Seeder) {
+	old := seeders
+	t.Cleanup(func() { seeders = old })
+
+	seeders = make(map[string]Seeder)
+	for _, s := range registered {
+		RegisterSeeder(s)
+	}
+}
+
+func seederNames(order []Seeder) []string {
+	var names []string
+	for _, s := range order {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestSeedOrder(t *testing.T) {
+	withSeeders(t,
+		Seeder{Name: "tokens", DependsOn: []string{"users"}},
+		Seeder{Name: "users"},
+		Seeder{Name: "posts", DependsOn: []string{"users", "tokens"}},
+	)
+
+	order, err := seedOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := seederNames(order)
+	if len(names) != 3 || names[0] != "users" || names[1] != "tokens" || names[2] != "posts" {
+		t.Errorf("expected [users tokens posts], got %v", names)
+	}
+
+	order, err = seedOrder("tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names = seederNames(order)
+	if len(names) != 2 || names[0] != "users" || names[1] != "tokens" {
+		t.Errorf("expected [users tokens], got %v", names)
+	}
+}
+
+func TestSeedOrder_Errors(t *testing.T) {
+	withSeeders(t,
+		Seeder{Name: "a", DependsOn: []string{"b"}},
+		Seeder{Name: "b", DependsOn: []string{"a"}},
+		Seeder{Name: "c", DependsOn: []string{"missing"}},
+	)
+
+	if _, err := seedOrder("a"); err == nil {
+		t.Error("expected an error for seeders that depend on each other, got nil")
+	}
+
+	if _, err := seedOrder("c"); err == nil {
+		t.Error("expected an error for a missing dependency, got nil")
+	}
+
+	if _, err := seedOrder("unknown"); err == nil {
+		t.Error("expected an error for an unknown seeder, got nil")
+	}
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// FixturesPath is the folder the seeders below load their fixture files from
+var FixturesPath = "data/fixtures"
+
+// the seeders below add an admin with a known password and a token for it, so they only run in
+// development and test
+
+func init() {
+	RegisterSeeder(Seeder{
+		Name:        "users",
+		Development: true,
+		Run: func(tx Models) error {
+			_, err := tx.LoadFixtures(filepath.Join(FixturesPath, "users.yml"))
+			return err
+		},
+	})
+
+	RegisterSeeder(Seeder{
+		Name:        "tokens",
+		DependsOn:   []string{"users"},
+		Development: true,
+		Run: func(tx Models) error {
+			user, err := tx.Users.ByEmail("admin@example.com")
+			if err != nil {
+				return err
+			}
+
+			token, err := tx.Tokens.GenerateToken(user.ID, 365*24*time.Hour)
+			if err != nil {
+				return err
+			}
+
+			// Insert replaces the tokens the user already has, so seeding twice still leaves one
+			return tx.Tokens.Insert(*token, *user)
+		},
+	})
+}
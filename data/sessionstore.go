@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SessionStore keeps sessions in the sessions table of the migrations, on mysql, mariadb and
+// sqlite. It is a store for scs, the session manager of Gemquick, which only has a store for
+// those databases when Gemquick opens the database itself, and never for sqlite.
+type SessionStore struct {
+	db     *sql.DB
+	sqlite bool
+}
+
+// NewSessionStore returns a session store on pool, a database of dbType
+func NewSessionStore(dbType string, pool *sql.DB) *SessionStore {
+	return &SessionStore{
+		db:     pool,
+		sqlite: dbType == "sqlite" || dbType == "sqlite3",
+	}
+}
+
+// Find returns the data of the session with token, found is false when there is no such
+// session or it has expired
+func (s *SessionStore) Find(token string) (b []byte, found bool, err error) {
+	// sqlite keeps the expiry as a julian day, like the sqlite store of scs
+	query := "SELECT data FROM sessions WHERE token = ? AND UTC_TIMESTAMP(6) < expiry"
+	if s.sqlite {
+		query = "SELECT data FROM sessions WHERE token = ? AND julianday('now') < expiry"
+	}
+
+	err = s.db.QueryRow(query, token).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit saves the session with token, replacing its data and expiry when it exists
+func (s *SessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	if s.sqlite {
+		_, err := s.db.Exec("REPLACE INTO sessions (token, data, expiry) VALUES (?, ?, julianday(?))",
+			token, b, expiry.UTC().Format("2006-01-02 15:04:05.000"))
+		return err
+	}
+
+	_, err := s.db.Exec("REPLACE INTO sessions (token, data, expiry) VALUES (?, ?, ?)", token, b, expiry.UTC())
+
+	return err
+}
+
+// Delete removes the session with token
+func (s *SessionStore) Delete(token string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE token = ?", token)
+
+	return err
+}
+
+// DeleteExpired removes the sessions that have expired
+func (s *SessionStore) DeleteExpired() error {
+	query := "DELETE FROM sessions WHERE expiry < UTC_TIMESTAMP(6)"
+	if s.sqlite {
+		query = "DELETE FROM sessions WHERE expiry < julianday('now')"
+	}
+
+	_, err := s.db.Exec(query)
+
+	return err
+}
+
+// Cleanup deletes the expired sessions every interval until ctx is done, onError, when not
+// nil, is called when that fails
+func (s *SessionStore) Cleanup(ctx context.Context, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.DeleteExpired(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -10,6 +10,8 @@ type Test struct {
     ID        int       `db:"id,omitempty"`
     CreatedAt time.Time `db:"created_at"`
     UpdatedAt time.Time `db:"updated_at"`
+
+    sess up.Session
 }
 
 // Table returns the table name
@@ -17,9 +19,19 @@ func (t *Test) Table() string {
     return "tests"
 }
 
+// session returns the session the model runs its queries on
+func (t *Test) session() up.Session {
+    return sessionOr(t.sess)
+}
+
+// readSession returns the session the model runs its reads on, see readSession
+func (t *Test) readSession() up.Session {
+    return readSession(t.sess)
+}
+
 // All gets all records from the database, using upper
 func (t *Test) All(condition up.Cond) ([]*Test, error) {
-    collection := upper.Collection(t.Table())
+    collection := t.readSession().Collection(t.Table())
     var all []*Test
 
     res := collection.Find(condition)
@@ -28,28 +40,36 @@ func (t *Test) All(condition up.Cond) ([]*Test, error) {
         return nil, err
     }
 
+    // records read in a transaction are saved in it too
+    for _, one := range all {
+        one.sess = t.sess
+    }
+
     return all, err
 }
 
 // Find gets one record from the database, by id, using upper
 func (t *Test) Find(id int) (*Test, error) {
     var one Test
-    collection := upper.Collection(t.Table())
+    collection := t.readSession().Collection(t.Table())
 
     res := collection.Find(up.Cond{"id": id})
     err := res.One(&one)
     if err != nil {
         return nil, err
     }
+    one.sess = t.sess
     return &one, nil
 }
 
 // Update updates a record in the database, using upper
 func (t *Test) Update(m Test) error {
     m.UpdatedAt = time.Now()
-    collection := upper.Collection(t.Table())
-    res := collection.Find(m.ID)
-    err := res.Update(&m)
+    err := withHooks(t.session(), hookUpdate, &m, func(tx Models) error {
+        collection := tx.session().Collection(t.Table())
+        res := collection.Find(m.ID)
+        return res.Update(&m)
+    })
     if err != nil {
         return err
     }
@@ -58,9 +78,12 @@ func (t *Test) Update(m Test) error {
 
 // Delete deletes a record from the database by id, using upper
 func (t *Test) Delete(id int) error {
-    collection := upper.Collection(t.Table())
-    res := collection.Find(id)
-    err := res.Delete()
+    m := Test{ID: id}
+    err := withHooks(t.session(), hookDelete, &m, func(tx Models) error {
+        collection := tx.session().Collection(t.Table())
+        res := collection.Find(id)
+        return res.Delete()
+    })
     if err != nil {
         return err
     }
@@ -71,20 +94,25 @@ func (t *Test) Delete(id int) error {
 func (t *Test) Create(m Test) (int, error) {
     m.CreatedAt = time.Now()
     m.UpdatedAt = time.Now()
-    collection := upper.Collection(t.Table())
-    res, err := collection.Insert(m)
+    err := withHooks(t.session(), hookCreate, &m, func(tx Models) error {
+        collection := tx.session().Collection(t.Table())
+        res, err := collection.Insert(m)
+        if err != nil {
+            return err
+        }
+        m.ID = getInsertID(res.ID())
+        return nil
+    })
     if err != nil {
         return 0, err
     }
 
-    id := getInsertID(res.ID())
-
-    return id, nil
+    return m.ID, nil
 }
 
 // Builder is an example of using upper's sql builder
 func (t *Test) Builder(id int) ([]*Test, error) {
-    collection := upper.Collection(t.Table())
+    collection := t.readSession().Collection(t.Table())
 
     var result []*Test
 
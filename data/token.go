@@ -22,17 +22,29 @@ type Token struct {
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 	ExpiresAt time.Time `db:"expiry" json:"expires_at"`
+
+	sess up.Session
 }
 
 func (t *Token) Table() string {
 	return "tokens"
 }
 
+// session returns the session the token model runs its queries on
+func (t *Token) session() up.Session {
+	return sessionOr(t.sess)
+}
+
+// readSession returns the session the token model runs its reads on, see readSession
+func (t *Token) readSession() up.Session {
+	return readSession(t.sess)
+}
+
 func (t *Token) GetUserForToken(token string) (*User, error) {
 	var user User
 	var theToken Token
 
-	collection := upper.Collection(t.Table())
+	collection := t.readSession().Collection(t.Table())
 	res := collection.Find(up.Cond{"token =": token})
 	err := res.One(&theToken)
 
@@ -40,7 +52,7 @@ func (t *Token) GetUserForToken(token string) (*User, error) {
 		return nil, err
 	}
 
-	collection = upper.Collection(user.Table())
+	collection = t.readSession().Collection(user.Table())
 	res = collection.Find(up.Cond{"id =": theToken.UserID})
 	err = res.One(&user)
 
@@ -49,13 +61,14 @@ func (t *Token) GetUserForToken(token string) (*User, error) {
 	}
 
 	user.Token = theToken
+	user.bind(t.sess)
 
 	return &user, nil
 }
 
 // get tokens for a user
 func (t *Token) GetTokensForUser(id int) ([]*Token, error) {
-	collection := upper.Collection(t.Table())
+	collection := t.readSession().Collection(t.Table())
 
 	var tokens []*Token
 
@@ -66,12 +79,16 @@ func (t *Token) GetTokensForUser(id int) ([]*Token, error) {
 		return nil, err
 	}
 
+	for _, token := range tokens {
+		token.sess = t.sess
+	}
+
 	return tokens, nil
 }
 
 // get a token by id
 func (t *Token) Find(id int) (*Token, error) {
-	collection := upper.Collection(t.Table())
+	collection := t.readSession().Collection(t.Table())
 
 	var token Token
 
@@ -82,12 +99,14 @@ func (t *Token) Find(id int) (*Token, error) {
 		return nil, err
 	}
 
+	token.sess = t.sess
+
 	return &token, nil
 }
 
 // get token by token
 func (t *Token) GetByToken(token string) (*Token, error) {
-	collection := upper.Collection(t.Table())
+	collection := t.readSession().Collection(t.Table())
 
 	var theToken Token
 
@@ -98,46 +117,82 @@ func (t *Token) GetByToken(token string) (*Token, error) {
 		return nil, err
 	}
 
+	theToken.sess = t.sess
+
 	return &theToken, nil
 }
 
 // delete token by id
 func (t *Token) Delete(id int) error {
-	collection := upper.Collection(t.Table())
+	token := Token{ID: id}
 
-	err := collection.Find(id).Delete()
+	err := withHooks(t.session(), hookDelete, &token, func(tx Models) error {
+		collection := tx.session().Collection(t.Table())
+
+		return collection.Find(id).Delete()
+	})
 
 	return err
 }
 
 // delete token by token
 func (t *Token) DeleteByToken(token string) error {
-	collection := upper.Collection(t.Table())
+	theToken := Token{PlainText: token}
+
+	err := withHooks(t.session(), hookDelete, &theToken, func(tx Models) error {
+		collection := tx.session().Collection(t.Table())
 
-	err := collection.Find(up.Cond{"token =": token}).Delete()
+		return collection.Find(up.Cond{"token =": token}).Delete()
+	})
 
 	return err
 }
 
-// insert token by token and user
-func (t *Token) Insert(token Token, user User) error {
-	collection := upper.Collection(t.Table())
+// delete all tokens of a user
+func (t *Token) DeleteByUserID(id int) error {
+	markWrite(t.session().Context())
 
-	// delete user's existing tokens
-	err := collection.Find(up.Cond{"user_id =": user.ID}).Delete()
+	collection := t.session().Collection(t.Table())
 
-	if err != nil {
-		return err
-	}
+	err := collection.Find(up.Cond{"user_id =": id}).Delete()
+
+	return err
+}
 
+// insert token by token and user, replacing the tokens the user has. Both run in one
+// transaction, which locks the user's row, so concurrent logins do not both keep a token.
+func (t *Token) Insert(token Token, user User) error {
 	token.CreatedAt = time.Now()
 	token.UpdatedAt = time.Now()
 	token.FirstName = user.FirstName
 	token.Email = user.Email
 
-	_, err = collection.Insert(token)
+	sess := t.session()
 
-	return err
+	return Models{}.bind(sess).Tx(sess.Context(), func(tx Models) error {
+		// sqlite has no row locks, it locks the database file for the delete below anyway
+		if databaseType() != "sqlite" {
+			_, err := tx.session().SQL().Exec("SELECT id FROM "+user.Table()+" WHERE id = ? FOR UPDATE", user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// delete user's existing tokens
+		err := tx.Tokens.DeleteByUserID(user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		return withHooks(tx.session(), hookCreate, &token, func(tx Models) error {
+			collection := tx.session().Collection(t.Table())
+
+			_, err := collection.Insert(token)
+
+			return err
+		})
+	})
 }
 
 // generate a token for a user with a ttl
@@ -158,6 +213,7 @@ func (t *Token) GenerateToken(userId int, ttl time.Duration) (*Token, error) {
 	token.Hash = hash[:]
 	token.CreatedAt = time.Now()
 	token.UpdatedAt = time.Now()
+	token.sess = t.sess
 
 	return &token, nil
 }
@@ -2,6 +2,8 @@ package data
 
 import (
 	"errors"
+	"myapp/validation"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -11,29 +13,68 @@ import (
 )
 
 type User struct {
-	ID        int       `db:"id,omitempty"`
-	FirstName string    `db:"first_name"`
-	LastName  string    `db:"last_name"`
-	Email     string    `db:"email"`
-	Password  string    `db:"password"`
-	Active    int       `db:"user_active"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
-	Token     Token     `db:"-"`
+	ID        int    `db:"id,omitempty" json:"id"`
+	FirstName string `db:"first_name" json:"first_name" validate:"required,min=2,max=255"`
+	LastName  string `db:"last_name" json:"last_name" validate:"required,min=2,max=255"`
+	Email     string `db:"email" json:"email" validate:"required,email,max=255,unique=users:email:ID"`
+	Password  string `db:"password" json:"-" audit:"redact"`
+	Active    int    `db:"user_active" json:"user_active"`
+	// Role is what the user may do besides using their own account, RoleAdmin or empty
+	Role string `db:"role" json:"role"`
+	// Phone is encrypted in the database and kept out of json, so also out of the outbox. It
+	// is found by its blind index PhoneIndex, see ByPhone.
+	Phone      EncryptedString `db:"phone" json:"-"`
+	PhoneIndex string          `db:"phone_index" json:"-" audit:"-"`
+	Version    int             `db:"version" json:"version" audit:"-"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at" audit:"-"`
+	UpdatedAt  time.Time       `db:"updated_at" json:"updated_at" audit:"-"`
+	Token      Token           `db:"-" json:"-"`
+
+	sess up.Session
 }
 
+// RoleAdmin is the role of the users that may see the accounts of others, e.g. their history
+const RoleAdmin = "admin"
+
 func (u *User) Table() string {
 	return "users"
 }
 
-func (u *User) Validate(validator *gemquick.Validation) {
-	validator.Check(u.FirstName != "", "first_name", "this field is required")
-	validator.Check(u.LastName != "", "last_name", "this field is required")
-	validator.IsEmail("email", u.Email)
+// RecordID returns the id of the user in the change history, see Auditable
+func (u *User) RecordID() int {
+	return u.ID
+}
+
+// session returns the session the user model runs its queries on
+func (u *User) session() up.Session {
+	return sessionOr(u.sess)
+}
+
+// readSession returns the session the user model runs its reads on, see readSession
+func (u *User) readSession() up.Session {
+	return readSession(u.sess)
+}
+
+// bind makes the user, and its token, run their queries on sess, the session of the model that
+// returned it, so that a user read in a transaction is also saved in it
+func (u *User) bind(sess up.Session) {
+	u.sess = sess
+	u.Token.sess = sess
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Validate adds an error to validator for every field that breaks the rules in its validate tag,
+// the error is that of a query of the unique rule that failed
+func (u *User) Validate(validator *gemquick.Validation) error {
+	return validation.StructWithRules(validator, u, validationRules(u.sess))
 }
 
 func (u *User) All() ([]*User, error) {
-	collection := upper.Collection(u.Table())
+	collection := u.readSession().Collection(u.Table())
 
 	var users []*User
 
@@ -44,11 +85,15 @@ func (u *User) All() ([]*User, error) {
 		return nil, err
 	}
 
+	for _, user := range users {
+		user.bind(u.sess)
+	}
+
 	return users, nil
 }
 
 func (u *User) Find(id int) (*User, error) {
-	collection := upper.Collection(u.Table())
+	collection := u.readSession().Collection(u.Table())
 
 	var user User
 
@@ -61,7 +106,7 @@ func (u *User) Find(id int) (*User, error) {
 
 	var token Token
 
-	collection = upper.Collection(token.Table())
+	collection = u.readSession().Collection(token.Table())
 	res = collection.Find(up.Cond{"user_id =": user.ID, "expiry >": time.Now()}).OrderBy("created_at desc").Limit(1)
 	err = res.One(&token)
 
@@ -72,12 +117,13 @@ func (u *User) Find(id int) (*User, error) {
 	}
 
 	user.Token = token
+	user.bind(u.sess)
 
 	return &user, nil
 }
 
 func (u *User) ByEmail(email string) (*User, error) {
-	collection := upper.Collection(u.Table())
+	collection := u.readSession().Collection(u.Table())
 
 	var user User
 
@@ -89,7 +135,7 @@ func (u *User) ByEmail(email string) (*User, error) {
 	}
 
 	var token Token
-	collection = upper.Collection(token.Table())
+	collection = u.readSession().Collection(token.Table())
 	res = collection.Find(up.Cond{"user_id =": user.ID, "expiry >": time.Now()}).OrderBy("created_at desc").Limit(1)
 	err = res.One(&token)
 
@@ -100,62 +146,164 @@ func (u *User) ByEmail(email string) (*User, error) {
 	}
 
 	user.Token = token
+	user.bind(u.sess)
 
 	return &user, nil
 }
 
+// Update saves the user, as long as nobody else has updated it since it was read.
+// ErrStaleRecord is returned if someone has.
 func (u *User) Update(user User) (*User, error) {
-	collection := upper.Collection(u.Table())
-
 	user.UpdatedAt = time.Now()
 
-	res := collection.Find(up.Cond{"id =": user.ID})
-	err := res.Update(user)
+	err := withHooks(u.session(), hookUpdate, &user, func(tx Models) error {
+		version := user.Version
+		user.Version++
+
+		err := updateVersioned(tx.session(), u.Table(), user.ID, version, user)
+
+		if err != nil {
+			user.Version = version
+		}
+
+		return err
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	user.bind(u.sess)
+
 	return &user, nil
 }
 
 func (u *User) Create(user User) (*User, error) {
-	collection := upper.Collection(u.Table())
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.Version = 1
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	err := withHooks(u.session(), hookCreate, &user, func(tx Models) error {
+		collection := tx.session().Collection(u.Table())
+
+		res, err := collection.Insert(user)
+
+		if err != nil {
+			return err
+		}
+
+		user.ID = getInsertID(res.ID)
+
+		return nil
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
-	user.Password = string(hashedPassword)
+	user.bind(u.sess)
 
-	res, err := collection.Insert(user)
+	return &user, nil
+}
+
+func (u *User) Delete(id int) error {
+	user := User{ID: id}
+
+	err := withHooks(u.session(), hookDelete, &user, func(tx Models) error {
+		collection := tx.session().Collection(u.Table())
+
+		res := collection.Find(up.Cond{"id =": id})
+		return res.Delete()
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ByPhone returns the user with the phone number phone, found by its blind index
+func (u *User) ByPhone(phone string) (*User, error) {
+	index, err := BlindIndex(normalizePhone(phone))
+	if err != nil {
+		return nil, err
+	}
+
+	collection := u.readSession().Collection(u.Table())
+
+	var user User
+
+	res := collection.Find(up.Cond{"phone_index =": index})
+	err = res.One(&user)
 
 	if err != nil {
 		return nil, err
 	}
 
-	user.ID = getInsertID(res.ID)
+	user.bind(u.sess)
 
 	return &user, nil
 }
 
-func (u *User) Delete(id int) error {
-	collection := upper.Collection(u.Table())
+// BeforeCreate hashes the password of the user before it is inserted
+func (u *User) BeforeCreate(tx Models) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), 12)
 
-	res := collection.Find(up.Cond{"id =": id})
-	err := res.Delete()
+	if err != nil {
+		return err
+	}
+
+	u.Password = string(hashedPassword)
 
+	return u.indexPhone()
+}
+
+// BeforeUpdate keeps the blind index of the phone number in step with it
+func (u *User) BeforeUpdate(tx Models) error {
+	return u.indexPhone()
+}
+
+// indexPhone sets PhoneIndex to the blind index of Phone, empty when there is no phone number
+func (u *User) indexPhone() error {
+	if u.Phone == "" {
+		u.PhoneIndex = ""
+		return nil
+	}
+
+	index, err := BlindIndex(normalizePhone(string(u.Phone)))
 	if err != nil {
 		return err
 	}
 
+	u.PhoneIndex = index
+
 	return nil
 }
 
+// normalizePhone strips the spaces, dashes and parentheses from a phone number, so that the
+// ways to write one number have the same blind index
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+
+		return r
+	}, phone)
+}
+
+// AfterCreate publishes a user.created event with the new user, in the transaction that inserted it
+func (u *User) AfterCreate(tx Models) error {
+	return tx.Publish("user.created", u)
+}
+
+// BeforeDelete revokes the tokens of the user before it is deleted
+func (u *User) BeforeDelete(tx Models) error {
+	return tx.Tokens.DeleteByUserID(u.ID)
+}
+
 func (u *User) ResetPassword(id int, password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 
@@ -163,7 +311,10 @@ func (u *User) ResetPassword(id int, password string) error {
 		return err
 	}
 
-	user, err := u.Find(id)
+	// read the user from the primary, a replica might not have its latest version yet
+	primary := User{sess: u.session().WithContext(UsePrimary(u.session().Context()))}
+
+	user, err := primary.Find(id)
 
 	if err != nil {
 		return err
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"fmt"
+	"myapp/validation"
+	"strings"
+
+	"github.com/jimmitjoo/gemquick"
+	db2 "github.com/upper/db/v4"
+)
+
+// init makes the unique and exists rules available to validation.Struct
+func init() {
+	for name, rule := range validationRules(nil) {
+		validation.RegisterRule(name, rule)
+	}
+}
+
+// Validate adds an error to validator for every field of s that breaks the rules in its
+// validate tag, with the unique and exists rules querying the session of the models. The
+// error is that of a query that failed, the fields it checks are not valid or invalid then.
+func (m Models) Validate(validator *gemquick.Validation, s interface{}) error {
+	return validation.StructWithRules(validator, s, validationRules(m.sess))
+}
+
+// validationRules returns the unique and exists rules, they check values against the database. Their params are separated
+// by colons, since commas separate the rules in a validate tag:
+//
+//	unique=table:column                   no row in table has the value in column
+//	unique=table:column:Field[:idColumn]  the same, ignoring the row whose id, or idColumn, is
+//	                                      the value of Field, so a record can keep its own value
+//	exists=table:column                   a row in table has the value in column
+//
+// The rules query sess, or the package wide session when sess is nil. A query that fails is
+// the error of the validation, not a message for the field, see validation.Field.Fail.
+func validationRules(sess db2.Session) validation.Rules {
+	return validation.Rules{
+		"unique": func(f validation.Field) string {
+			count, err := countMatching(sessionOr(sess), f)
+			if err != nil {
+				f.Fail(fmt.Errorf("checking %s: %w", f.Name, err))
+				return ""
+			}
+
+			if count > 0 {
+				return fmt.Sprintf("%s is already taken", f.Label)
+			}
+
+			return ""
+		},
+		"exists": func(f validation.Field) string {
+			count, err := countMatching(sessionOr(sess), f)
+			if err != nil {
+				f.Fail(fmt.Errorf("checking %s: %w", f.Name, err))
+				return ""
+			}
+
+			if count == 0 {
+				return fmt.Sprintf("%s does not exist", f.Label)
+			}
+
+			return ""
+		},
+	}
+}
+
+// countMatching counts the rows with the value of f, in the table and column of its param
+func countMatching(sess db2.Session, f validation.Field) (uint64, error) {
+	params := strings.Split(f.Param, ":")
+	if len(params) < 2 || len(params) > 4 {
+		panic(fmt.Sprintf("data: %s needs table:column[:Field[:idColumn]], not %q", f.StructField.Name, f.Param))
+	}
+
+	cond := db2.Cond{params[1]: f.Value.Interface()}
+
+	if len(params) > 2 {
+		idColumn := "id"
+		if len(params) > 3 {
+			idColumn = params[3]
+		}
+
+		except := f.Struct.FieldByName(params[2])
+		if !except.IsValid() {
+			panic(fmt.Sprintf("data: %s refers to unknown field %q", f.StructField.Name, params[2]))
+		}
+
+		if !except.IsZero() {
+			cond[idColumn+" !="] = except.Interface()
+		}
+	}
+
+	// the session is the primary's, a replica might not have the latest rows yet
+	return sess.Collection(params[0]).Find(cond).Count()
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"errors"
+
+	db2 "github.com/upper/db/v4"
+)
+
+// ErrStaleRecord is returned when a record that uses a version column has been
+// changed by someone else since it was read
+var ErrStaleRecord = errors.New("record has been modified since it was read")
+
+// updateVersioned saves record to the row with id in table, but only while the row
+// still has version. The record passed in must carry the bumped version. When no row
+// is updated because the version has changed, ErrStaleRecord is returned.
+func updateVersioned(sess db2.Session, table string, id, version int, record interface{}) error {
+	res, err := sess.SQL().
+		Update(table).
+		Set(record).
+		Where("id = ? AND version = ?", id, version).
+		Exec()
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	exists, err := sess.Collection(table).Find(db2.Cond{"id =": id}).Exists()
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return db2.ErrNoMoreRows
+	}
+
+	return ErrStaleRecord
+}
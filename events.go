@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"myapp/data"
+)
+
+// registerEventHandlers registers the handlers the outbox relay delivers events to. Events
+// can be delivered more than once, handlers use the EventID to skip events they have seen.
+func (a *application) registerEventHandlers() {
+	data.HandleOutbox("user.created", func(ctx context.Context, event data.OutboxEvent) error {
+		var user data.User
+
+		err := event.Decode(&user)
+		if err != nil {
+			return err
+		}
+
+		a.App.InfoLog.Printf("user created: %s %s <%s>, event %s", user.FirstName, user.LastName, user.Email, event.EventID)
+
+		return nil
+	})
+}
@@ -0,0 +1,318 @@
+// Package generator writes the Go code of models from the columns of existing tables, read
+// with data.Models.Columns, so that new models do not have to be copied from data/test.go.
+//
+//	myapp make model blog_posts
+//
+// writes data/blog_post.go with a BlogPost struct and its CRUD methods, and
+// data/blog_post_test.go with a table driven test to fill in.
+package generator
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"myapp/data"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// initialisms are written in upper case in field names, e.g. user_id becomes UserID
+var initialisms = map[string]bool{
+	"api": true, "html": true, "http": true, "id": true, "ip": true,
+	"json": true, "sql": true, "url": true, "uuid": true, "xml": true,
+}
+
+// Model is a model to generate
+type Model struct {
+	// Name is the name of the struct, e.g. BlogPost
+	Name   string
+	Table  string
+	Fields []Field
+	// PrimaryKey is the field of the primary key, it is one of Fields
+	PrimaryKey Field
+}
+
+// Field is a field of a model and the column it is stored in
+type Field struct {
+	Name   string
+	Column string
+	// Type is the Go type of the field, nullable columns get a sql.Null* type
+	Type string
+}
+
+// NewModel returns the model for table with columns. name is the name of the struct, when it
+// is empty the table name is used, in singular, e.g. BlogPost for blog_posts.
+func NewModel(table, name string, columns []data.Column) (Model, error) {
+	if name == "" {
+		name = goName(singular(table))
+	}
+
+	if !token.IsIdentifier(name) {
+		return Model{}, fmt.Errorf("%q is not a valid model name", name)
+	}
+
+	m := Model{Name: name, Table: table}
+
+	keys := 0
+
+	for _, c := range columns {
+		f := Field{Name: goName(c.Name), Column: c.Name, Type: goType(c)}
+
+		if c.PrimaryKey {
+			m.PrimaryKey = f
+			keys++
+		}
+
+		m.Fields = append(m.Fields, f)
+	}
+
+	if keys == 0 {
+		return Model{}, fmt.Errorf("table %s has no primary key", table)
+	} else if keys > 1 {
+		return Model{}, fmt.Errorf("table %s has a primary key of %d columns, only single column keys are supported", table, keys)
+	}
+
+	return m, nil
+}
+
+// FileName returns the name of the file of the model, e.g. blog_post.go
+func (m Model) FileName() string {
+	return snakeCase(m.Name) + ".go"
+}
+
+// TestFileName returns the name of the file of the model test, e.g. blog_post_test.go
+func (m Model) TestFileName() string {
+	return snakeCase(m.Name) + "_test.go"
+}
+
+// Receiver returns the name of the receiver of the model methods, e.g. b for BlogPost
+func (m Model) Receiver() string {
+	return strings.ToLower(m.Name[:1])
+}
+
+// Var returns the name of variables holding a record, e.g. blogPost for BlogPost
+func (m Model) Var() string {
+	v := varName(m.Name)
+	if v == m.Receiver() {
+		v += "Record"
+	}
+
+	return v
+}
+
+// Var returns the name of variables holding a value of the field, e.g. userID for UserID
+func (f Field) Var() string {
+	return varName(f.Name)
+}
+
+// Field returns the field stored in column, and false when the model has no such field
+func (m Model) Field(column string) (Field, bool) {
+	for _, f := range m.Fields {
+		if f.Column == column {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// FieldName returns the name of the field stored in column
+func (m Model) FieldName(column string) string {
+	f, _ := m.Field(column)
+	return f.Name
+}
+
+// Timestamp reports whether the model has a time.Time field stored in column, the generated
+// methods set created_at and updated_at
+func (m Model) Timestamp(column string) bool {
+	f, ok := m.Field(column)
+	return ok && f.Type == "time.Time"
+}
+
+// Versioned reports whether updates check the version column, like User does, see ErrStaleRecord
+func (m Model) Versioned() bool {
+	f, ok := m.Field("version")
+	return ok && f.Type == "int" && m.PrimaryKey.Column == "id" && m.PrimaryKey.Type == "int"
+}
+
+// AutoIncrement reports whether the database assigns the primary key on insert
+func (m Model) AutoIncrement() bool {
+	return m.PrimaryKey.Type == "int"
+}
+
+// Imports returns the standard library packages the fields of the model use
+func (m Model) Imports() []string {
+	seen := make(map[string]bool)
+
+	for _, f := range m.Fields {
+		if strings.HasPrefix(f.Type, "sql.") {
+			seen["database/sql"] = true
+		}
+		if strings.Contains(f.Type, "time.") {
+			seen["time"] = true
+		}
+	}
+
+	if m.Timestamp("created_at") || m.Timestamp("updated_at") {
+		seen["time"] = true
+	}
+
+	var imports []string
+	for i := range seen {
+		imports = append(imports, i)
+	}
+	sort.Strings(imports)
+
+	return imports
+}
+
+// Source returns the formatted source of the model and of its test
+func Source(m Model) (model, test []byte, err error) {
+	model, err = render("model.go.tmpl", m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	test, err = render("model_test.go.tmpl", m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return model, test, nil
+}
+
+func render(name string, m Model) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := templates.ExecuteTemplate(&buf, name, m)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting %s: %w", name, err)
+	}
+
+	return source, nil
+}
+
+// goType returns the Go type of the values of c
+func goType(c data.Column) string {
+	base := strings.ToLower(c.DataType)
+	if i := strings.Index(base, "("); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+
+	switch base {
+	case "smallint", "integer", "int", "bigint", "tinyint", "mediumint", "int2", "int4", "int8", "serial", "bigserial", "smallserial":
+		if c.Nullable {
+			return "sql.NullInt64"
+		}
+		return "int"
+	case "real", "double precision", "double", "float", "numeric", "decimal":
+		if c.Nullable {
+			return "sql.NullFloat64"
+		}
+		return "float64"
+	case "boolean", "bool":
+		if c.Nullable {
+			return "sql.NullBool"
+		}
+		return "bool"
+	case "date", "datetime", "time", "timestamp", "timestamp without time zone", "timestamp with time zone":
+		if c.Nullable {
+			return "sql.NullTime"
+		}
+		return "time.Time"
+	case "bytea", "blob", "binary", "varbinary", "tinyblob", "mediumblob", "longblob":
+		// a nil slice is NULL
+		return "[]byte"
+	}
+
+	// text, and every type without a better match, e.g. json, uuid and enums
+	if c.Nullable {
+		return "sql.NullString"
+	}
+	return "string"
+}
+
+// reservedVars are the names the generated methods use for their own variables
+var reservedVars = map[string]bool{
+	"all": true, "collection": true, "condition": true, "err": true,
+	"one": true, "res": true, "tx": true, "version": true,
+}
+
+// varName returns a variable name for a Go name, e.g. blogPost for BlogPost and id for ID
+func varName(name string) string {
+	v := strings.ToLower(name[:1]) + name[1:]
+	if strings.ToUpper(name) == name {
+		v = strings.ToLower(name)
+	}
+
+	if token.IsKeyword(v) || reservedVars[v] {
+		v += "Value"
+	}
+
+	return v
+}
+
+// goName turns a snake_case name into a Go name, e.g. user_id into UserID
+func goName(name string) string {
+	var b strings.Builder
+
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+
+	return b.String()
+}
+
+// snakeCase turns a Go name into snake_case, e.g. BlogPost into blog_post and UserID into user_id
+func snakeCase(name string) string {
+	var b strings.Builder
+
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteRune('_')
+		}
+
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// singular returns the singular of an English table name, for the common plurals
+func singular(table string) string {
+	switch {
+	case strings.HasSuffix(table, "ies"):
+		return strings.TrimSuffix(table, "ies") + "y"
+	case strings.HasSuffix(table, "sses"), strings.HasSuffix(table, "xes"), strings.HasSuffix(table, "ches"), strings.HasSuffix(table, "shes"):
+		return strings.TrimSuffix(table, "es")
+	case strings.HasSuffix(table, "ss"):
+		return table
+	case strings.HasSuffix(table, "s"):
+		return strings.TrimSuffix(table, "s")
+	}
+
+	return table
+}
@@ -0,0 +1,156 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"myapp/data"
+)
+
+var postColumns = []data.Column{
+	{Name: "id", DataType: "integer", PrimaryKey: true},
+	{Name: "user_id", DataType: "bigint"},
+	{Name: "title", DataType: "character varying"},
+	{Name: "body", DataType: "text", Nullable: true},
+	{Name: "rating", DataType: "numeric(4,2)", Nullable: true},
+	{Name: "published_at", DataType: "timestamp without time zone", Nullable: true},
+	{Name: "version", DataType: "int"},
+	{Name: "created_at", DataType: "datetime"},
+	{Name: "updated_at", DataType: "timestamp"},
+}
+
+func TestNewModel(t *testing.T) {
+	m, err := NewModel("blog_posts", "", postColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Name != "BlogPost" || m.FileName() != "blog_post.go" || m.TestFileName() != "blog_post_test.go" {
+		t.Errorf("wrong names: %s, %s, %s", m.Name, m.FileName(), m.TestFileName())
+	}
+
+	if m.PrimaryKey.Name != "ID" || !m.AutoIncrement() || !m.Versioned() {
+		t.Errorf("wrong primary key: %+v", m.PrimaryKey)
+	}
+
+	var want = map[string]string{
+		"UserID":      "int",
+		"Title":       "string",
+		"Body":        "sql.NullString",
+		"Rating":      "sql.NullFloat64",
+		"PublishedAt": "sql.NullTime",
+		"CreatedAt":   "time.Time",
+	}
+
+	for _, f := range m.Fields {
+		if typ, ok := want[f.Name]; ok && typ != f.Type {
+			t.Errorf("expected %s to be a %s, got %s", f.Name, typ, f.Type)
+		}
+	}
+
+	if strings.Join(m.Imports(), " ") != "database/sql time" {
+		t.Error("wrong imports:", m.Imports())
+	}
+}
+
+func TestNewModel_Errors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		model   string
+		columns []data.Column
+	}{
+		{"no primary key", "", []data.Column{{Name: "id", DataType: "int"}}},
+		{"composite primary key", "", []data.Column{
+			{Name: "post_id", DataType: "int", PrimaryKey: true},
+			{Name: "tag_id", DataType: "int", PrimaryKey: true},
+		}},
+		{"invalid name", "Blog Post", postColumns},
+	}
+
+	for _, e := range tests {
+		_, err := NewModel("posts_tags", e.model, e.columns)
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	m, _ := NewModel("blog_posts", "", postColumns)
+
+	model, test, err := Source(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"type BlogPost struct",
+		"ID          int             `db:\"id,omitempty\" json:\"id\"`",
+		"Body        sql.NullString  `db:\"body\" json:\"body\"`",
+		"func (b *BlogPost) Find(id int) (*BlogPost, error)",
+		"blogPost.ID = getInsertID(res.ID)",
+		"updateVersioned(tx.session(), b.Table(), blogPost.ID, version, blogPost)",
+	} {
+		if !strings.Contains(string(model), expected) {
+			t.Errorf("model does not contain %q:\n%s", expected, model)
+		}
+	}
+
+	if !strings.Contains(string(test), "func TestBlogPost_CRUD(t *testing.T)") {
+		t.Errorf("test does not contain the test function:\n%s", test)
+	}
+
+	// the test runs on the migrated test database, it fails rather than skips without the table
+	if strings.Contains(string(test), "t.Skip") || !strings.Contains(string(test), `Collection("blog_posts").Exists()`) {
+		t.Errorf("test does not check for the table:\n%s", test)
+	}
+}
+
+func TestSource_StringKey(t *testing.T) {
+	m, err := NewModel("settings", "", []data.Column{
+		{Name: "key", DataType: "varchar(255)", PrimaryKey: true},
+		{Name: "value", DataType: "text"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model, _, err := Source(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"func (s *Setting) Find(key string) (*Setting, error)",
+		"_, err := collection.Insert(setting)",
+		`res := collection.Find(up.Cond{"key =": setting.Key})`,
+	} {
+		if !strings.Contains(string(model), expected) {
+			t.Errorf("model does not contain %q:\n%s", expected, model)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	var tests = []struct {
+		table, goName, singular, snake string
+	}{
+		{"users", "Users", "user", "users"},
+		{"blog_posts", "BlogPosts", "blog_post", "blog_posts"},
+		{"categories", "Categories", "category", "categories"},
+		{"addresses", "Addresses", "address", "addresses"},
+		{"api_keys", "APIKeys", "api_key", "api_keys"},
+	}
+
+	for _, e := range tests {
+		if goName(e.table) != e.goName {
+			t.Errorf("expected goName(%s) to be %s, got %s", e.table, e.goName, goName(e.table))
+		}
+		if singular(e.table) != e.singular {
+			t.Errorf("expected singular(%s) to be %s, got %s", e.table, e.singular, singular(e.table))
+		}
+		if snakeCase(e.goName) != e.snake {
+			t.Errorf("expected snakeCase(%s) to be %s, got %s", e.goName, e.snake, snakeCase(e.goName))
+		}
+	}
+}
@@ -7,14 +7,19 @@ replace github.com/jimmitjoo/gemquick => ../gemquick
 require (
 	github.com/CloudyKit/jet/v6 v6.2.0
 	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/alexedwards/scs/redisstore v0.0.0-20230305114126-a07530f96ced
 	github.com/go-chi/chi/v5 v5.0.8
+	github.com/go-sql-driver/mysql v1.7.0
+	github.com/gomodule/redigo v1.8.9
 	github.com/jackc/pgconn v1.14.0
 	github.com/jackc/pgx/v4 v4.18.1
 	github.com/jimmitjoo/gemquick v0.0.0-00010101000000-000000000000
+	github.com/joho/godotenv v1.5.1
 	github.com/justinas/nosurf v1.1.1
 	github.com/ory/dockertest/v3 v3.9.1
 	github.com/upper/db/v4 v4.6.0
 	golang.org/x/crypto v0.6.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -25,7 +30,6 @@ require (
 	github.com/alexedwards/scs v1.4.1 // indirect
 	github.com/alexedwards/scs/mysqlstore v0.0.0-20230305114126-a07530f96ced // indirect
 	github.com/alexedwards/scs/postgresstore v0.0.0-20230305114126-a07530f96ced // indirect
-	github.com/alexedwards/scs/redisstore v0.0.0-20230305114126-a07530f96ced // indirect
 	github.com/alexedwards/scs/v2 v2.5.0 // indirect
 	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2 // indirect
 	github.com/cenkalti/backoff/v4 v4.1.3 // indirect
@@ -34,10 +38,8 @@ require (
 	github.com/docker/docker v20.10.13+incompatible // indirect
 	github.com/docker/go-connections v0.4.0 // indirect
 	github.com/docker/go-units v0.4.0 // indirect
-	github.com/go-sql-driver/mysql v1.7.0 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang-migrate/migrate/v4 v4.15.2 // indirect
-	github.com/gomodule/redigo v1.8.9 // indirect
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
@@ -48,8 +50,8 @@ require (
 	github.com/jackc/pgproto3/v2 v2.3.2 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
 	github.com/jackc/pgtype v1.14.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/lib/pq v1.10.4 // indirect
+	github.com/mattn/go-sqlite3 v1.14.16 // indirect
 	github.com/mitchellh/mapstructure v1.4.1 // indirect
 	github.com/moby/term v0.0.0-20210619224110-3f7ff695adc6 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
@@ -65,5 +67,4 @@ require (
 	golang.org/x/net v0.6.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
 	golang.org/x/text v0.7.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
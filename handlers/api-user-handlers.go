@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"myapp/apiversion"
+	"myapp/apperror"
+	"myapp/binding"
+	"myapp/data"
+	"net/http"
+	"time"
+)
+
+// UserResource is how the api shows a user, it never has the password or the tokens
+type UserResource struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Active    int       `json:"user_active"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newUserResource(u *data.User) UserResource {
+	return UserResource{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Active:    u.Active,
+		Version:   u.Version,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// UserStoreRequest is the body of requests that create a user
+type UserStoreRequest struct {
+	FirstName string `json:"first_name" validate:"required,min=2,max=255"`
+	LastName  string `json:"last_name" validate:"required,min=2,max=255"`
+	Email     string `json:"email" validate:"required,email,max=255"`
+	Password  string `json:"password" validate:"required,min=8"`
+	// Active is 1 when it is left out
+	Active *int `json:"user_active"`
+}
+
+// UserUpdateRequest is the body of requests that update a user
+type UserUpdateRequest struct {
+	ID        int    `json:"-" path:"id"`
+	FirstName string `json:"first_name" validate:"required,min=2,max=255"`
+	LastName  string `json:"last_name" validate:"required,min=2,max=255"`
+	Email     string `json:"email" validate:"required,email,max=255"`
+	// Active keeps the value of the user when it is left out
+	Active *int `json:"user_active"`
+	// Version, when it is set, is the version of the user the update is based on
+	Version int `json:"version"`
+}
+
+// userPath is the id of the user in the url
+type userPath struct {
+	ID int `path:"id"`
+}
+
+// UsersIndex writes all users, newest first
+func (h *Handlers) UsersIndex(w http.ResponseWriter, r *http.Request) error {
+	models := h.Models.WithContext(r.Context())
+
+	users, err := models.Users.All()
+	if err != nil {
+		return err
+	}
+
+	resources := make([]UserResource, 0, len(users))
+	for _, u := range users {
+		resources = append(resources, newUserResource(u))
+	}
+
+	return h.App.WriteJson(w, http.StatusOK, resources)
+}
+
+// UsersShow writes the user with the id in the url
+func (h *Handlers) UsersShow(w http.ResponseWriter, r *http.Request) error {
+	var path userPath
+	err := binding.Bind(r, &path)
+	if err != nil {
+		return err
+	}
+
+	user, err := findUser(h.Models.WithContext(r.Context()), path.ID)
+	if err != nil {
+		return err
+	}
+
+	return h.App.WriteJson(w, http.StatusOK, newUserResource(user))
+}
+
+// UsersStore creates a user from the json body, and answers with 201 and the new user, or with
+// 422 and the errors by field when the body is not valid
+func (h *Handlers) UsersStore(w http.ResponseWriter, r *http.Request) error {
+	var input UserStoreRequest
+
+	err := binding.Bind(r, &input)
+	if err != nil {
+		return err
+	}
+
+	user := data.User{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Email:     input.Email,
+		Password:  input.Password,
+		Active:    1,
+	}
+	if input.Active != nil {
+		user.Active = *input.Active
+	}
+
+	models := h.Models.WithContext(r.Context())
+
+	// the rules of the model, e.g. that the email is not taken, checked with the request's context
+	validator := h.App.Validator(nil)
+	err = models.Validate(validator, &user)
+	if err != nil {
+		return err
+	}
+
+	if !validator.Valid() {
+		return apperror.Invalid("the user is not valid", validator.Errors)
+	}
+
+	created, err := models.Users.Create(user)
+	if err != nil {
+		return err
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/%s/users/%d", apiversion.FromContext(r.Context()), created.ID))
+
+	return h.App.WriteJson(w, http.StatusCreated, newUserResource(created), headers)
+}
+
+// UsersUpdate replaces the fields of the user with the id in the url with the json body. When
+// the body has a version the update only succeeds while the user still has it, otherwise the
+// answer is 409 with the user as it is now.
+func (h *Handlers) UsersUpdate(w http.ResponseWriter, r *http.Request) error {
+	var input UserUpdateRequest
+
+	err := binding.Bind(r, &input)
+	if err != nil {
+		return err
+	}
+
+	// read from the primary, a replica might not have the latest version of the user yet
+	models := h.Models.WithContext(data.UsePrimary(r.Context()))
+
+	user, err := findUser(models, input.ID)
+	if err != nil {
+		return err
+	}
+
+	user.FirstName = input.FirstName
+	user.LastName = input.LastName
+	user.Email = input.Email
+	if input.Active != nil {
+		user.Active = *input.Active
+	}
+	if input.Version != 0 {
+		user.Version = input.Version
+	}
+
+	validator := h.App.Validator(nil)
+	err = user.Validate(validator)
+	if err != nil {
+		return err
+	}
+
+	if !validator.Valid() {
+		return apperror.Invalid("the user is not valid", validator.Errors)
+	}
+
+	updated, err := models.Users.Update(*user)
+	if errors.Is(err, data.ErrStaleRecord) {
+		current, err := findUser(models, user.ID)
+		if err != nil {
+			return err
+		}
+
+		return h.App.WriteJson(w, http.StatusConflict, newUserResource(current))
+	} else if errors.Is(err, data.ErrNotFound) {
+		// deleted since it was read
+		return userNotFound()
+	} else if err != nil {
+		return err
+	}
+
+	return h.App.WriteJson(w, http.StatusOK, newUserResource(updated))
+}
+
+// UsersDestroy deletes the user with the id in the url and answers with 204
+func (h *Handlers) UsersDestroy(w http.ResponseWriter, r *http.Request) error {
+	var path userPath
+	err := binding.Bind(r, &path)
+	if err != nil {
+		return err
+	}
+
+	models := h.Models.WithContext(data.UsePrimary(r.Context()))
+
+	user, err := findUser(models, path.ID)
+	if err != nil {
+		return err
+	}
+
+	err = models.Users.Delete(user.ID)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// findUser returns the user with id, or the error for a user that does not exist
+func findUser(models data.Models, id int) (*data.User, error) {
+	user, err := models.Users.Find(id)
+	if errors.Is(err, data.ErrNotFound) {
+		return nil, userNotFound()
+	}
+
+	return user, err
+}
+
+func userNotFound() *apperror.Error {
+	return apperror.NotFound("user_not_found", "there is no user with this id")
+}
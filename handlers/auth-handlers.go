@@ -21,7 +21,9 @@ func (h *Handlers) PostUserLogin(w http.ResponseWriter, r *http.Request) {
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
-	user, err := h.Models.Users.ByEmail(email)
+	models := h.Models.WithContext(r.Context())
+
+	user, err := models.Users.ByEmail(email)
 	if err != nil {
 		w.Write([]byte(err.Error()))
 	}
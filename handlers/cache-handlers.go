@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"fmt"
+	"myapp/apperror"
+	"myapp/binding"
 	"net/http"
 
 	"github.com/justinas/nosurf"
@@ -13,156 +16,120 @@ func (h *Handlers) ShowCachePage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handlers) SaveInCache(w http.ResponseWriter, r *http.Request) {
+// cacheResponse is the answer of the cache handlers
+type cacheResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Value   string `json:"value,omitempty"`
+}
+
+func (h *Handlers) SaveInCache(w http.ResponseWriter, r *http.Request) error {
 	var userInput struct {
 		Name  string `json:"name"`
 		Value string `json:"value"`
 		CSRF  string `json:"csrf_token"`
 	}
 
-	err := h.App.ReadJson(w, r, &userInput)
+	err := binding.Bind(r, &userInput)
 	if err != nil {
-		h.App.Error500(w, r)
-		return
+		return err
 	}
 
-	// Verify CSRF token
-	if !nosurf.VerifyToken(nosurf.Token(r), userInput.CSRF) {
-		h.App.Error500(w, r)
-		return
+	err = verifyCSRF(r, userInput.CSRF)
+	if err != nil {
+		return err
 	}
 
 	err = h.App.Cache.Set(userInput.Name, userInput.Value)
 	if err != nil {
-		h.App.Error500(w, r)
-		return
+		return apperror.Internal(err)
 	}
 
-	var resp struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
-	}
-
-	resp.Error = false
-	resp.Message = "Successfully saved in cache"
-
-	_ = h.App.WriteJson(w, http.StatusCreated, resp)
-
+	return h.App.WriteJson(w, http.StatusCreated, cacheResponse{Message: "Successfully saved in cache"})
 }
 
-func (h *Handlers) GetFromCache(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) GetFromCache(w http.ResponseWriter, r *http.Request) error {
 	var userInput struct {
 		Name string `json:"name"`
 		CSRF string `json:"csrf_token"`
 	}
 
-	var msg string
-	var inCache = true
-
-	err := h.App.ReadJson(w, r, &userInput)
+	err := binding.Bind(r, &userInput)
 	if err != nil {
-		h.App.Error500(w, r)
-		return
+		return err
 	}
 
-	// Verify CSRF token
-	if !nosurf.VerifyToken(nosurf.Token(r), userInput.CSRF) {
-		h.App.Error500(w, r)
-		return
+	err = verifyCSRF(r, userInput.CSRF)
+	if err != nil {
+		return err
 	}
 
 	value, err := h.App.Cache.Get(userInput.Name)
 	if err != nil {
-		msg = "Failed to retrieve from cache"
-		inCache = false
-	}
-
-	var resp struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
-		Value   string `json:"value"`
+		return apperror.Wrap(err, http.StatusNotFound, "cache_miss", "Failed to retrieve from cache")
 	}
 
-	if inCache {
-		msg = "Successfully retrieved from cache"
-		resp.Error = false
-		resp.Message = msg
-		resp.Value = value.(string)
-	} else {
-		resp.Error = true
-		resp.Message = msg
+	s, ok := value.(string)
+	if !ok {
+		return apperror.Internal(fmt.Errorf("cached value of %s is a %T, not a string", userInput.Name, value))
 	}
 
-	_ = h.App.WriteJson(w, http.StatusOK, resp)
+	return h.App.WriteJson(w, http.StatusOK, cacheResponse{Message: "Successfully retrieved from cache", Value: s})
 }
 
-func (h *Handlers) DeleteFromCache(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DeleteFromCache(w http.ResponseWriter, r *http.Request) error {
 	var userInput struct {
 		Name string `json:"name"`
 		CSRF string `json:"csrf_token"`
 	}
 
-	err := h.App.ReadJson(w, r, &userInput)
-
+	err := binding.Bind(r, &userInput)
 	if err != nil {
-		h.App.Error500(w, r)
-		return
+		return err
 	}
 
-	// Verify CSRF token
-	if !nosurf.VerifyToken(nosurf.Token(r), userInput.CSRF) {
-		h.App.Error500(w, r)
-		return
+	err = verifyCSRF(r, userInput.CSRF)
+	if err != nil {
+		return err
 	}
 
 	err = h.App.Cache.Forget(userInput.Name)
-
 	if err != nil {
-		h.App.Error500(w, r)
-		return
-	}
-
-	var resp struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
+		return apperror.Internal(err)
 	}
 
-	resp.Error = false
-	resp.Message = "Successfully deleted from cache"
-
-	_ = h.App.WriteJson(w, http.StatusOK, resp)
+	return h.App.WriteJson(w, http.StatusOK, cacheResponse{Message: "Successfully deleted from cache"})
 }
 
-func (h *Handlers) EmptyCache(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) EmptyCache(w http.ResponseWriter, r *http.Request) error {
 	var userInput struct {
 		CSRF string `json:"csrf_token"`
 	}
 
-	err := h.App.ReadJson(w, r, &userInput)
+	err := binding.Bind(r, &userInput)
 	if err != nil {
-		h.App.Error500(w, r)
-		return
+		return err
 	}
 
-	// Verify CSRF token
-	if !nosurf.VerifyToken(nosurf.Token(r), userInput.CSRF) {
-		h.App.Error500(w, r)
-		return
+	err = verifyCSRF(r, userInput.CSRF)
+	if err != nil {
+		return err
 	}
 
 	err = h.App.Cache.Flush()
 	if err != nil {
-		h.App.Error500(w, r)
-		return
+		return apperror.Internal(err)
 	}
 
-	var resp struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
-	}
+	return h.App.WriteJson(w, http.StatusOK, cacheResponse{Message: "Successfully emptied cache"})
+}
 
-	resp.Error = false
-	resp.Message = "Successfully emptied cache"
+// verifyCSRF returns a 403 error when token is not the csrf token of the session of r. The
+// json requests of the cache page are under /api/, which nosurf does not check itself.
+func verifyCSRF(r *http.Request, token string) error {
+	if !nosurf.VerifyToken(nosurf.Token(r), token) {
+		return apperror.Forbidden("csrf_token_invalid", "the csrf token is missing or not valid, reload the page")
+	}
 
-	_ = h.App.WriteJson(w, http.StatusOK, resp)
+	return nil
 }
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"context"
+	"myapp/apperror"
+	"myapp/negotiate"
 	"net/http"
+	"strings"
 
+	"github.com/CloudyKit/jet/v6"
 	"github.com/jimmitjoo/gemquick"
 )
 
@@ -64,3 +68,71 @@ func (h *Handlers) decrypt(crypto string) (string, error) {
 
 	return encrypted, nil
 }
+
+// HandlerFunc is a handler that returns its errors instead of writing the error response
+// itself, see Handle
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Handle returns a handler that runs fn and renders the error it returns, see apperror.Render
+func (h *Handlers) Handle(fn HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r)
+		if err != nil {
+			h.Error(w, r, err)
+		}
+	}
+}
+
+// Error renders err as problem+json, or as the error page for browsers
+func (h *Handlers) Error(w http.ResponseWriter, r *http.Request, err error) {
+	apperror.Render(h.App, w, r, err)
+}
+
+// RespondOptions are the options of Respond
+type RespondOptions struct {
+	// View is the Jet view html is rendered with, html is only offered when there is one
+	View string
+	// Vars are the variables of the view, the data is passed to it as its data
+	Vars jet.VarMap
+	// Headers are added to the response
+	Headers http.Header
+}
+
+// Respond writes data with status in the format the request asks for, see package negotiate:
+// html with the view in opts, json or xml. Requests for another format get 406.
+func (h *Handlers) Respond(w http.ResponseWriter, r *http.Request, status int, data interface{}, opts RespondOptions) {
+	offered := []string{negotiate.JSON, negotiate.XML}
+	if opts.View != "" {
+		offered = append([]string{negotiate.HTML}, offered...)
+	}
+
+	for key, values := range opts.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	// caches must keep a response for every format
+	w.Header().Add("Vary", "Accept")
+
+	var err error
+
+	switch negotiate.Negotiate(r, offered...) {
+	case negotiate.HTML:
+		if opts.Vars == nil {
+			opts.Vars = make(jet.VarMap)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		err = h.App.Render.JetPage(w, r, opts.View, opts.Vars, data)
+	case negotiate.JSON:
+		err = h.App.WriteJson(w, status, data)
+	case negotiate.XML:
+		err = h.App.WriteXML(w, status, data)
+	default:
+		h.Error(w, r, apperror.New(http.StatusNotAcceptable, "not_acceptable", "this resource is available as "+strings.Join(offered, ", ")))
+	}
+
+	if err != nil {
+		h.App.ErrorLog.Println("error responding:", err)
+	}
+}
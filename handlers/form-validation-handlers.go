@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"myapp/binding"
 	"myapp/data"
 	"net/http"
 
@@ -21,26 +23,35 @@ func (h *Handlers) Form(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) PostForm(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		h.App.ErrorLog.Println("error parsing form:", err)
+	var input struct {
+		FirstName string `form:"first_name"`
+		LastName  string `form:"last_name"`
+		Email     string `form:"email"`
 	}
 
 	validator := h.App.Validator(nil)
 
-	validator.Required(r, "first_name", "last_name", "email")
-	validator.IsEmail("email", r.Form.Get("email"))
+	err := binding.Bind(r, &input)
+
+	var bindErr *binding.Error
+	if errors.As(err, &bindErr) && len(bindErr.Fields) > 0 {
+		bindErr.AddTo(validator)
+	} else if err != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	user := data.User{FirstName: input.FirstName, LastName: input.LastName, Email: input.Email}
 
-	validator.Check(len(r.Form.Get("first_name")) > 1, "first_name", "First name must be at least 2 characters long")
-	validator.Check(len(r.Form.Get("last_name")) > 1, "last_name", "First name must be at least 2 characters long")
+	err = h.Models.WithContext(r.Context()).Validate(validator, &user)
+	if err != nil {
+		h.Error(w, r, err)
+		return
+	}
 
 	if !validator.Valid() {
 		vars := make(jet.VarMap)
 		vars.Set("validator", validator)
-		var user data.User
-		user.FirstName = r.Form.Get("first_name")
-		user.LastName = r.Form.Get("last_name")
-		user.Email = r.Form.Get("email")
 		vars.Set("user", user)
 
 		err := h.App.Render.Page(w, r, "form", vars, nil)
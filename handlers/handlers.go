@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"myapp/apiversion"
 	"myapp/data"
 	"net/http"
 	"time"
@@ -13,6 +14,8 @@ import (
 type Handlers struct {
 	App    *gemquick.Gemquick
 	Models data.Models
+	// APIVersions are the versions of the api, oldest first
+	APIVersions apiversion.Versions
 }
 
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"myapp/apiversion"
+	"myapp/data"
+	"net/http"
+
+	"github.com/jimmitjoo/gemquick/cache"
+)
+
+// PoolStats writes the statistics of the database connection pools and, when the cache is
+// redis, of the redis pool as json, to see whether the pool limits in .env fit the load
+func (h *Handlers) PoolStats(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Databases map[string]poolStats `json:"databases"`
+		Redis     *redisPoolStats      `json:"redis,omitempty"`
+	}
+
+	payload.Databases = make(map[string]poolStats)
+	for name, stats := range data.PoolStats() {
+		payload.Databases[name] = poolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDuration:       stats.WaitDuration.String(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+
+	if redisCache, ok := h.App.Cache.(*cache.RedisCache); ok {
+		stats := redisCache.Conn.Stats()
+		payload.Redis = &redisPoolStats{
+			ActiveCount:  stats.ActiveCount,
+			IdleCount:    stats.IdleCount,
+			WaitCount:    stats.WaitCount,
+			WaitDuration: stats.WaitDuration.String(),
+		}
+	}
+
+	err := h.App.WriteJson(w, http.StatusOK, payload)
+	if err != nil {
+		h.App.ErrorLog.Println("error writing json:", err)
+	}
+}
+
+// APIVersionUsage writes the versions of the api as json, with their deprecation and sunset
+// and how many requests they served, to tell when a version can be retired. With a redis cache
+// the counts are of all the instances of the app, else of this one since it started.
+func (h *Handlers) APIVersionUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := apiversion.Usage()
+	if err != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	payload := make([]apiVersionUsage, 0, len(h.APIVersions))
+	for _, version := range h.APIVersions {
+		v := apiVersionUsage{Version: version.Name, VersionUsage: usage[version.Name]}
+		if version.IsDeprecated() {
+			v.Deprecated = version.Deprecated.Format("2006-01-02")
+		}
+		if !version.Sunset.IsZero() {
+			v.Sunset = version.Sunset.Format("2006-01-02")
+		}
+		payload = append(payload, v)
+	}
+
+	err = h.App.WriteJson(w, http.StatusOK, payload)
+	if err != nil {
+		h.App.ErrorLog.Println("error writing json:", err)
+	}
+}
+
+// apiVersionUsage is a version of the api with its usage
+type apiVersionUsage struct {
+	Version    string `json:"version"`
+	Deprecated string `json:"deprecated,omitempty"`
+	Sunset     string `json:"sunset,omitempty"`
+	apiversion.VersionUsage
+}
+
+// poolStats are the fields of sql.DBStats, with the wait duration readable
+type poolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+// redisPoolStats are the fields of redis.PoolStats, with the wait duration readable
+type redisPoolStats struct {
+	ActiveCount  int    `json:"active_count"`
+	IdleCount    int    `json:"idle_count"`
+	WaitCount    int64  `json:"wait_count"`
+	WaitDuration string `json:"wait_duration"`
+}
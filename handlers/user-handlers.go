@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"myapp/apperror"
+	"myapp/binding"
+	"myapp/data"
+	"net/http"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// userHistory is the history of a user in json and xml
+type userHistory struct {
+	XMLName xml.Name           `json:"-" xml:"history"`
+	UserID  int                `json:"user_id" xml:"user_id,attr"`
+	Changes []data.ModelChange `json:"changes" xml:"change"`
+}
+
+// UserHistory shows the recorded changes of a user, oldest first, as a page, or as json or xml
+// for /users/{id}/history.json and .xml or the Accept header. Users see their own history, and
+// admins that of every user.
+func (h *Handlers) UserHistory(w http.ResponseWriter, r *http.Request) error {
+	var path userPath
+	err := binding.Bind(r, &path)
+	if err != nil {
+		return err
+	}
+
+	models := h.Models.WithContext(r.Context())
+
+	// the history has the old and new values of the user, like the email addresses
+	userID := h.App.Session.GetInt(r.Context(), "userID")
+	if userID != path.ID {
+		current, err := models.Users.Find(userID)
+		if err != nil && !errors.Is(err, data.ErrNotFound) {
+			return err
+		}
+
+		if current == nil || !current.IsAdmin() {
+			return apperror.Forbidden("not_your_history", "you can only see the history of your own account")
+		}
+	}
+
+	changes, err := models.History(h.Models.Users.Table(), path.ID)
+	if err != nil {
+		return err
+	}
+
+	vars := make(jet.VarMap)
+	vars.Set("userID", path.ID)
+	vars.Set("changes", changes)
+
+	h.Respond(w, r, http.StatusOK, userHistory{UserID: path.ID, Changes: changes}, RespondOptions{
+		View: "user-history",
+		Vars: vars,
+	})
+
+	return nil
+}
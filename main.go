@@ -1,21 +1,157 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"myapp/data"
 	"myapp/handlers"
 	"myapp/middleware"
+	"myapp/openapi"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/jimmitjoo/gemquick"
 )
 
+// shutdownTimeout is how long the requests in flight get to finish when the app is stopped
+const shutdownTimeout = 30 * time.Second
+
 type application struct {
 	App        *gemquick.Gemquick
 	Handlers   *handlers.Handlers
 	Models     data.Models
 	Middleware *middleware.Middleware
+	// DBs are the named database connections besides the primary one, e.g. DBs["analytics"]
+	DBs map[string]*sql.DB
+	// API describes the routes under /api/ for the document served at /api/openapi.json
+	API *openapi.Spec
 }
 
 func main() {
 	g := initApplication()
-	g.App.ListenAndServe()
+
+	err := g.run(os.Args[1:])
+
+	// close the connections before exiting, also when the command failed
+	g.closeConnections()
+
+	if err != nil {
+		g.App.ErrorLog.Fatal(err)
+	}
+}
+
+// run runs the command in args, or serves the app when there is none
+func (a *application) run(args []string) error {
+	// seed the database instead of serving, e.g. "myapp seed users tokens", or "myapp seed" for all seeders
+	if len(args) > 0 && args[0] == "seed" {
+		return a.seed(args[1:])
+	}
+
+	// move an encrypted column to the current key instead of serving, e.g. "myapp reencrypt users phone"
+	if len(args) > 0 && args[0] == "reencrypt" {
+		if len(args) != 3 {
+			return errors.New("usage: reencrypt <table> <column>")
+		}
+
+		changed, err := a.Models.Reencrypt(args[1], args[2])
+		if err == nil {
+			a.App.InfoLog.Printf("re-encrypted %d values", changed)
+		}
+
+		return err
+	}
+
+	// generate code instead of serving, e.g. "myapp make model blog_posts"
+	if len(args) > 1 && args[0] == "make" && args[1] == "model" {
+		return a.makeModel(args[2:])
+	}
+
+	// run migrations instead of serving, e.g. "myapp migrate up" or "myapp migrate down 2"
+	if len(args) > 0 && args[0] == "migrate" {
+		return a.migrate(args[1:])
+	}
+
+	err := a.migrateOnBoot()
+	if err != nil {
+		return err
+	}
+
+	// deliver the events in the outbox while serving
+	a.registerEventHandlers()
+
+	return a.serve()
+}
+
+// serve serves the app until it is interrupted or terminated. It then stops accepting requests
+// and waits for the ones in flight and the outbox relay, so that the connections can be closed.
+func (a *application) serve() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	relay := a.Models.OutboxRelay()
+	relay.ErrorLog = a.App.ErrorLog
+
+	relayDone := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(relayDone)
+	}()
+
+	// the settings of Gemquick's ListenAndServe, which can not be shut down
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%s", os.Getenv("PORT")),
+		ErrorLog:     a.App.ErrorLog,
+		Handler:      a.App.Routes,
+		IdleTimeout:  30 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 600 * time.Second,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		a.App.InfoLog.Printf("Listening on port %s", os.Getenv("PORT"))
+		served <- srv.ListenAndServe()
+	}()
+
+	var err error
+
+	select {
+	case err = <-served:
+		stop()
+	case <-ctx.Done():
+		a.App.InfoLog.Println("shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err = srv.Shutdown(shutdownCtx)
+	}
+
+	<-relayDone
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// closeConnections closes the primary database, the named database connections and the read replicas
+func (a *application) closeConnections() {
+	err := data.CloseConnections()
+	if err != nil {
+		a.App.ErrorLog.Println("error closing database connections:", err)
+	}
+
+	if a.App.DB.Pool != nil {
+		err = a.App.DB.Pool.Close()
+		if err != nil {
+			a.App.ErrorLog.Println("error closing the database:", err)
+		}
+	}
 }
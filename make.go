@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"myapp/generator"
+)
+
+// makeModel writes a model and its test to data/ from the columns of a table, args are the
+// table and optionally the name of the model, e.g. "blog_posts" or "blog_posts Post"
+func (a *application) makeModel(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: make model <table> [name]")
+	}
+
+	name := ""
+	if len(args) == 2 {
+		name = args[1]
+	}
+
+	columns, err := a.Models.Columns(args[0])
+	if err != nil {
+		return err
+	}
+
+	model, err := generator.NewModel(args[0], name, columns)
+	if err != nil {
+		return err
+	}
+
+	source, test, err := generator.Source(model)
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{
+		filepath.Join(a.App.RootPath, "data", model.FileName()):     source,
+		filepath.Join(a.App.RootPath, "data", model.TestFileName()): test,
+	}
+
+	// never overwrite a model that might have been edited since it was generated
+	for path := range files {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	for path, content := range files {
+		err := os.WriteFile(path, content, 0644)
+		if err != nil {
+			return err
+		}
+
+		a.App.InfoLog.Println("created", path)
+	}
+
+	a.App.InfoLog.Printf("add %s to Models, New and bind in data/models.go to use it through Models", model.Name)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"myapp/apiversion"
+	"myapp/apperror"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiPrefix is where the versioned route groups are, /api/v1 and so on
+const apiPrefix = "/api/"
+
+// APIVersion routes requests to /api without a version in the url to the route group of the
+// version the Accept header asks for, or of the oldest version, so that /api/users is served
+// by /api/v1/users. Paths that no version has a route for, like /api/docs, are left alone, and
+// a request for a version that does not exist gets 406.
+func (m *Middleware) APIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routeContext := chi.RouteContext(r.Context())
+		if routeContext == nil || len(m.APIVersions) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// URLFormat may have removed a suffix already
+		path := routeContext.RoutePath
+		if path == "" {
+			path = r.URL.Path
+		}
+
+		if !strings.HasPrefix(path, apiPrefix) || m.App.Routes.Match(chi.NewRouteContext(), r.Method, path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version := m.APIVersions.Default()
+		if name := apiversion.FromAccept(r); name != "" {
+			var ok bool
+			version, ok = m.APIVersions.Find(name)
+			if !ok {
+				apperror.Render(m.App, w, r, apperror.New(http.StatusNotAcceptable, "unknown_api_version", "there is no api version "+name))
+				return
+			}
+		}
+
+		versioned := apiPrefix + version.Name + "/" + strings.TrimPrefix(path, apiPrefix)
+		if !m.App.Routes.Match(chi.NewRouteContext(), r.Method, versioned) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		routeContext.RoutePath = versioned
+		// the response depends on the version in the Accept header
+		w.Header().Add("Vary", "Accept")
+
+		next.ServeHTTP(w, r.WithContext(apiversion.WithVersion(r.Context(), version.Name)))
+	})
+}
+
+// Version is the middleware of the route group of version: it counts the request and, when
+// the version is deprecated, sets the Deprecation and Sunset headers. Requests APIVersion
+// routed here have the version in their context already, they are counted as unversioned.
+func (m *Middleware) Version(version apiversion.Version) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			unversioned := apiversion.FromContext(r.Context()) != ""
+			err := apiversion.Count(version.Name, unversioned)
+			if err != nil {
+				m.App.ErrorLog.Println("error counting the request:", err)
+			}
+
+			version.SetHeaders(w.Header())
+
+			next.ServeHTTP(w, r.WithContext(apiversion.WithVersion(r.Context(), version.Name)))
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"myapp/data"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AuditContext attributes the model changes a request makes to the logged in user and the
+// id of the request, see data.WithAuditContext. Changes made without a logged in user are
+// recorded with actor 0, AuthToken attributes api requests to the user of the token.
+func (m *Middleware) AuditContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actorID := m.App.Session.GetInt(r.Context(), "userID")
+
+		ctx := data.WithAuditContext(r.Context(), actorID, middleware.GetReqID(r.Context()))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -1,21 +1,28 @@
 package middleware
 
-import "net/http"
+import (
+	"myapp/apperror"
+	"myapp/data"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
 
 func (m *Middleware) AuthToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := m.Models.Tokens.AuthenticateToken(r)
+		models := m.Models.WithContext(r.Context())
+		user, err := models.Tokens.AuthenticateToken(r)
 
 		if err != nil {
-			var payload struct {
-				Error   bool   `json:"error"`
-				Message string `json:"message"`
-			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apperror.Render(m.App, w, r, apperror.Unauthorized("invalid_token", "invalid authentication credentials"))
+			return
+		}
 
-			payload.Error = true
-			payload.Message = "invalid authentication credentials"
+		// the changes the request makes are made by the user of the token, not by whoever
+		// is logged in to the session, see AuditContext
+		ctx := data.WithAuditContext(r.Context(), user.ID, middleware.GetReqID(r.Context()))
 
-			_ = m.App.WriteJson(w, http.StatusUnauthorized, payload)
-		}
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -1,11 +1,18 @@
 package middleware
 
-import "net/http"
+import (
+	"myapp/apperror"
+	"net/http"
+)
 
+// Auth lets only logged in users through, everyone else gets 401
 func (m *Middleware) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !m.App.Session.Exists(r.Context(), "userID") {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			apperror.Render(m.App, w, r, apperror.Unauthorized("login_required", "log in to see this page"))
+			return
 		}
+
+		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"myapp/apperror"
+	"net/http"
+	"strings"
+)
+
+// Internal lets only requests with the HEALTH_TOKEN of .env as their bearer token through, for
+// the routes that show the internals of the app to monitoring. Without a HEALTH_TOKEN the
+// routes are not served at all.
+func (m *Middleware) Internal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.HealthToken == "" {
+			apperror.Render(m.App, w, r, apperror.NotFound("not_found", "there is nothing here"))
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(m.HealthToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apperror.Render(m.App, w, r, apperror.Unauthorized("invalid_token", "invalid authentication credentials"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
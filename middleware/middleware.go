@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"myapp/apiversion"
 	"myapp/data"
 
 	"github.com/jimmitjoo/gemquick"
@@ -9,4 +10,8 @@ import (
 type Middleware struct {
 	App    *gemquick.Gemquick
 	Models data.Models
+	// HealthToken is the bearer token of the internal routes, see Internal
+	HealthToken string
+	// APIVersions are the versions of the api, oldest first, see APIVersion
+	APIVersions apiversion.Versions
 }
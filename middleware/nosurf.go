@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/justinas/nosurf"
+)
+
+// NoSurf checks the csrf token of the requests that change something, like the NoSurf of
+// Gemquick, but it does not check anything under /api/. Gemquick only exempts /api/*, which
+// matches one path segment, so /api/users/5 and /api/v1/users were rejected. The api is
+// authenticated with tokens, and the json routes of the pages, like /api/save-in-cache, check
+// the token themselves with nosurf.Token, which still works for the exempt paths.
+func (m *Middleware) NoSurf(next http.Handler) http.Handler {
+	csrfHandler := nosurf.New(next)
+	secure, _ := strconv.ParseBool(os.Getenv("COOKIE_SECURE"))
+
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, apiPrefix)
+	})
+
+	csrfHandler.SetBaseCookie(http.Cookie{
+		HttpOnly: true,
+		Path:     "/",
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+	})
+
+	return csrfHandler
+}
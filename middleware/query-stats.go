@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"myapp/data"
+	"net/http"
+)
+
+// repeatedQueryThreshold is how often one statement may run in a request before it is
+// logged as a likely N+1 problem
+const repeatedQueryThreshold = 3
+
+// QueryStats counts the statements every request runs with its context. In debug mode the
+// count and the time spent on them is logged, and statements that are repeated are always
+// logged, since they usually mean that a loop runs a query for every row.
+func (m *Middleware) QueryStats(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := data.WithQueryStats(r.Context())
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		stats := data.QueryStatsFrom(ctx)
+
+		if m.App.Debug && stats.Count() > 0 {
+			m.App.InfoLog.Printf("%s %s: %d queries in %s", r.Method, r.URL.Path, stats.Count(), stats.Duration())
+		}
+
+		for query, count := range stats.Repeated(repeatedQueryThreshold) {
+			m.App.ErrorLog.Printf("%s %s: ran %d times, is it an N+1 query? %s", r.Method, r.URL.Path, count, query)
+		}
+	})
+}
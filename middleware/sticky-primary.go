@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"myapp/data"
+	"net/http"
+)
+
+// StickyPrimary sends the reads of a request to the primary database once the request has
+// written, so that it does not read from a replica that has not caught up yet
+func (m *Middleware) StickyPrimary(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(data.WithStickyPrimary(r.Context())))
+	})
+}
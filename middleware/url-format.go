@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"myapp/negotiate"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// URLFormat lets every route be asked for as json or xml with a .json or .xml suffix, e.g.
+// /users/5/history.json. The suffix is removed before the route is looked up and kept in the
+// context for Respond. Routes that end in .json themselves, like /api/openapi.json, are left
+// alone.
+func (m *Middleware) URLFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format, path := negotiate.Suffix(r.URL.Path)
+		routeContext := chi.RouteContext(r.Context())
+
+		if format == "" || routeContext == nil || m.App.Routes.Match(chi.NewRouteContext(), r.Method, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		routeContext.RoutePath = path
+
+		next.ServeHTTP(w, r.WithContext(negotiate.WithFormat(r.Context(), format)))
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"myapp/data"
+)
+
+const migrateUsage = "usage: migrate up | down [n] | status | force <version> | fresh"
+
+// migrator returns a migrator for the migrations folder of the app
+func (a *application) migrator() *data.Migrator {
+	return data.NewMigrator(a.App.DB.Pool, filepath.Join(a.App.RootPath, "migrations"))
+}
+
+// migrate runs a migration command, args are what follows "migrate", e.g. "down 2"
+func (a *application) migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+	m := a.migrator()
+
+	switch args[0] {
+	case "up":
+		ran, err := m.Up(ctx)
+		a.logMigrations("migrated", ran)
+		return err
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil {
+				return errors.New(migrateUsage)
+			}
+		}
+
+		ran, err := m.Down(ctx, n)
+		a.logMigrations("rolled back", ran)
+		return err
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			state := "pending"
+			if s.Dirty {
+				state = "dirty"
+			} else if s.Applied {
+				state = "applied"
+			}
+
+			fmt.Printf("%-8s %d_%s\n", state, s.Version, s.Name)
+		}
+
+		return nil
+
+	case "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New(migrateUsage)
+		}
+
+		err = m.Force(ctx, version)
+		if err == nil {
+			a.App.InfoLog.Println("forced version", version)
+		}
+		return err
+
+	case "fresh":
+		// fresh drops every table, make sure it never runs against production
+		if !a.App.Debug {
+			return errors.New("migrate fresh drops every table, it only runs with DEBUG=true")
+		}
+
+		ran, err := m.Fresh(ctx)
+		a.logMigrations("migrated", ran)
+		return err
+	}
+
+	return errors.New(migrateUsage)
+}
+
+// migrateOnBoot runs the pending migrations when MIGRATE_ON_BOOT is true. Every instance can
+// do it, the migrations are locked so only one of them runs them.
+func (a *application) migrateOnBoot() error {
+	if os.Getenv("MIGRATE_ON_BOOT") != "true" {
+		return nil
+	}
+
+	ran, err := a.migrator().Up(context.Background())
+	a.logMigrations("migrated", ran)
+
+	return err
+}
+
+func (a *application) logMigrations(action string, migrations []data.Migration) {
+	for _, migration := range migrations {
+		a.App.InfoLog.Printf("%s %d_%s", action, migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tokens;DROP TABLE IF EXISTS remember_tokens;DROP TABLE IF EXISTS users;
\ No newline at end of file
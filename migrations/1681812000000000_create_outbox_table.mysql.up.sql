@@ -0,0 +1,12 @@
+CREATE TABLE outbox (
+    id int NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    event_id varchar(32) NOT NULL UNIQUE,
+    topic varchar(255) NOT NULL,
+    payload text NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error varchar(2048) NOT NULL DEFAULT '',
+    available_at datetime(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    delivered_at datetime(6) NULL,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX outbox_pending (delivered_at, available_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
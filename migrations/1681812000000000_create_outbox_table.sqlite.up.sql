@@ -0,0 +1,13 @@
+CREATE TABLE outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id varchar(32) NOT NULL UNIQUE,
+    topic varchar(255) NOT NULL,
+    payload text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    available_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at datetime,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX outbox_pending ON outbox (available_at) WHERE delivered_at IS NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE outbox (
+    id SERIAL PRIMARY KEY,
+    event_id character varying(32) NOT NULL UNIQUE,
+    topic character varying(255) NOT NULL,
+    payload text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    available_at timestamp without time zone NOT NULL DEFAULT now(),
+    delivered_at timestamp without time zone,
+    created_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX outbox_pending ON outbox (available_at) WHERE delivered_at IS NULL;
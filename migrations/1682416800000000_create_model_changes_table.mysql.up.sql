@@ -0,0 +1,11 @@
+CREATE TABLE model_changes (
+    id int NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    table_name varchar(255) NOT NULL,
+    record_id int NOT NULL,
+    action varchar(10) NOT NULL,
+    changes text NOT NULL,
+    actor_id int NOT NULL DEFAULT 0,
+    request_id varchar(255) NOT NULL DEFAULT '',
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX model_changes_record (table_name, record_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+CREATE TABLE model_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name varchar(255) NOT NULL,
+    record_id integer NOT NULL,
+    action varchar(10) NOT NULL,
+    changes text NOT NULL,
+    actor_id integer NOT NULL DEFAULT 0,
+    request_id varchar(255) NOT NULL DEFAULT '',
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX model_changes_record ON model_changes (table_name, record_id);
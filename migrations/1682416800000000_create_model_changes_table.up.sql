@@ -0,0 +1,12 @@
+CREATE TABLE model_changes (
+    id SERIAL PRIMARY KEY,
+    table_name character varying(255) NOT NULL,
+    record_id integer NOT NULL,
+    action character varying(10) NOT NULL,
+    changes text NOT NULL,
+    actor_id integer NOT NULL DEFAULT 0,
+    request_id character varying(255) NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX model_changes_record ON model_changes (table_name, record_id);
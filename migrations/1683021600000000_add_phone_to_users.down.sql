@@ -0,0 +1,3 @@
+DROP INDEX users_phone_index;
+ALTER TABLE users DROP COLUMN phone_index;
+ALTER TABLE users DROP COLUMN phone;
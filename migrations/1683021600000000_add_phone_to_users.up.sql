@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN phone varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN phone_index varchar(64) NOT NULL DEFAULT '';
+CREATE INDEX users_phone_index ON users (phone_index);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN role varchar(20) NOT NULL DEFAULT '';
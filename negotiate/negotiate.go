@@ -0,0 +1,164 @@
+// Package negotiate picks the format of a response from what the client asks for: the
+// .json or .xml suffix of the url, see WithFormat, or else the Accept header, with its
+// q-values. It is used by Handlers.Respond, so that one route serves both the browser and
+// api clients.
+package negotiate
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The media types Respond offers
+const (
+	HTML = "text/html"
+	JSON = "application/json"
+	XML  = "application/xml"
+)
+
+// suffixes are the media types of the url suffixes
+var suffixes = map[string]string{
+	"json": JSON,
+	"xml":  XML,
+}
+
+// aliases are media types clients ask for that are served as another type
+var aliases = map[string]string{
+	"text/xml":              XML,
+	"application/xhtml+xml": HTML,
+}
+
+type contextKey struct{}
+
+// Suffix returns the format of the suffix of path, json for /users/5.json, and path without
+// it, or "" and path when it has no suffix with a format
+func Suffix(path string) (format, trimmed string) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 || strings.Contains(path[i:], "/") {
+		return "", path
+	}
+
+	format = strings.ToLower(path[i+1:])
+	if _, ok := suffixes[format]; !ok {
+		return "", path
+	}
+
+	return format, path[:i]
+}
+
+// WithFormat returns a context that asks for the format, json or xml, of the url suffix
+func WithFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, contextKey{}, format)
+}
+
+// Format returns the format of the url suffix in ctx, or "" when there was none
+func Format(ctx context.Context) string {
+	format, _ := ctx.Value(contextKey{}).(string)
+	return format
+}
+
+// Negotiate returns the media type of offered, in order of preference, that fits r best. A
+// url suffix wins over the Accept header, and a request without either gets the first offer.
+// It returns "" when none of offered is acceptable, the request should get 406.
+func Negotiate(r *http.Request, offered ...string) string {
+	if format := Format(r.Context()); format != "" {
+		for _, offer := range offered {
+			if offer == suffixes[format] {
+				return offer
+			}
+		}
+
+		return ""
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		if len(offered) == 0 {
+			return ""
+		}
+		return offered[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		// offers earlier in the list win ties
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// mediaRange is a media range of an Accept header, e.g. text/* with q=0.8
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		if alias, ok := aliases[mediaType]; ok {
+			mediaType = alias
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		typ, subtype := splitType(mediaType)
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+
+	return ranges
+}
+
+// quality returns the q-value ranges give offer, from the most specific range that matches
+// it, so that text/html;q=0 excludes html even with */*
+func quality(ranges []mediaRange, offer string) float64 {
+	typ, subtype := splitType(offer)
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+
+	return q
+}
+
+func splitType(mediaType string) (typ, subtype string) {
+	i := strings.Index(mediaType, "/")
+	if i < 0 {
+		return mediaType, ""
+	}
+
+	return mediaType[:i], mediaType[i+1:]
+}
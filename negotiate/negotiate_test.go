@@ -0,0 +1,62 @@
+package negotiate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		accept  string
+		format  string
+		offered []string
+		want    string
+	}{
+		{"no accept", "", "", []string{HTML, JSON}, HTML},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", []string{JSON, XML, HTML}, HTML},
+		{"api client", "application/json", "", []string{HTML, JSON, XML}, JSON},
+		{"q-values", "application/json;q=0.5, application/xml", "", []string{HTML, JSON, XML}, XML},
+		{"text/xml", "text/xml", "", []string{HTML, JSON, XML}, XML},
+		{"wildcard", "*/*", "", []string{JSON, XML}, JSON},
+		{"type wildcard", "application/*", "", []string{HTML, XML, JSON}, XML},
+		{"excluded", "text/html;q=0, */*", "", []string{HTML, JSON}, JSON},
+		{"not acceptable", "image/png", "", []string{HTML, JSON, XML}, ""},
+		{"suffix wins", "text/html", "json", []string{HTML, JSON}, JSON},
+		{"suffix not offered", "", "xml", []string{HTML, JSON}, ""},
+	}
+
+	for _, e := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if e.accept != "" {
+			r.Header.Set("Accept", e.accept)
+		}
+		if e.format != "" {
+			r = r.WithContext(WithFormat(r.Context(), e.format))
+		}
+
+		if got := Negotiate(r, e.offered...); got != e.want {
+			t.Errorf("%s: expected %q, got %q", e.name, e.want, got)
+		}
+	}
+}
+
+func TestSuffix(t *testing.T) {
+	var tests = []struct {
+		path, format, trimmed string
+	}{
+		{"/users/5.json", "json", "/users/5"},
+		{"/users/5/history.XML", "xml", "/users/5/history"},
+		{"/users/5", "", "/users/5"},
+		{"/public/app.css", "", "/public/app.css"},
+		{"/v1.2/users", "", "/v1.2/users"},
+	}
+
+	for _, e := range tests {
+		format, trimmed := Suffix(e.path)
+		if format != e.format || trimmed != e.trimmed {
+			t.Errorf("%s: expected %q and %q, got %q and %q", e.path, e.format, e.trimmed, format, trimmed)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package openapi generates an OpenAPI 3 document from the routes of a chi router, so that
+// the api docs can not drift from the routes. The routes are described where they are
+// registered, with the Go types of their bodies:
+//
+//	spec.Describe(http.MethodPost, "/api/users", openapi.Operation{
+//		Summary:   "Create a user",
+//		Request:   handlers.UserStoreRequest{},
+//		Responses: openapi.Responses{http.StatusCreated: handlers.UserResource{}},
+//	})
+//
+// The schemas are derived from the json tags of the types, and from their validate tags, see
+// package validation: required fields are listed as required, min and max become lengths or
+// limits and email becomes the email format.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Version is the OpenAPI version of the generated documents
+const Version = "3.0.3"
+
+// bearerAuth is the name of the security scheme of operations with Auth
+const bearerAuth = "bearerAuth"
+
+// pathParamRegex matches the parameters in chi patterns, e.g. {id} and {id:[0-9]+}
+var pathParamRegex = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// Operation describes what a route does, for the document
+type Operation struct {
+	// ID is the operationId, unique in the document, e.g. createUser
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	// Parameters are the query, header and path parameters, path parameters that are not
+	// listed are added as strings
+	Parameters []Parameter
+	// Request is a value of the type of the json body, nil when there is none
+	Request interface{}
+	// Responses are values of the types of the json bodies by status code, nil for responses
+	// without a body
+	Responses Responses
+	// Auth marks operations that need a token in the Authorization header
+	Auth       bool
+	Deprecated bool
+}
+
+// Responses are values of the types of response bodies by status code
+type Responses map[int]interface{}
+
+// Parameter is a parameter of an operation
+type Parameter struct {
+	Name string
+	// In is where the parameter is: path, query or header
+	In          string
+	Description string
+	Required    bool
+	// Type is a value of the type of the parameter, a string when it is nil
+	Type interface{}
+}
+
+// Spec collects the descriptions of routes and generates the document from them
+type Spec struct {
+	Title   string
+	Version string
+	// PathPrefix limits the document to the routes with patterns that start with it, e.g. /api/
+	PathPrefix string
+
+	mu         sync.RWMutex
+	operations map[string]Operation
+}
+
+// New returns a spec for the api with title and version, that documents the routes under prefix
+func New(title, version, prefix string) *Spec {
+	return &Spec{
+		Title:      title,
+		Version:    version,
+		PathPrefix: prefix,
+		operations: make(map[string]Operation),
+	}
+}
+
+// Describe describes the route for method and pattern, the pattern the route was registered with
+func (s *Spec) Describe(method, pattern string, op Operation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.operations[operationKey(method, pattern)] = op
+}
+
+// Generate returns the document of the routes of routes. Routes that have not been described
+// are documented with what the route itself tells: its method, its path and its parameters.
+func (s *Spec) Generate(routes chi.Routes) (*Document, error) {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: s.Title, Version: s.Version},
+		Paths:   make(map[string]PathItem),
+	}
+
+	types := newSchemas()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	auth := false
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = normalizePattern(route)
+		if !strings.HasPrefix(route, s.PathPrefix) {
+			return nil
+		}
+
+		op := s.operations[operationKey(method, route)]
+		auth = auth || op.Auth
+
+		path := pathParamRegex.ReplaceAllString(route, "{$1}")
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+
+		item[strings.ToLower(method)] = s.operation(types, route, op)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(types.components) > 0 || auth {
+		doc.Components = &Components{Schemas: types.components}
+	}
+	if auth {
+		doc.Components.SecuritySchemes = map[string]SecurityScheme{
+			bearerAuth: {Type: "http", Scheme: "bearer"},
+		}
+	}
+
+	return doc, nil
+}
+
+// operation returns the document of op, the operation of the route with pattern
+func (s *Spec) operation(types *schemas, pattern string, op Operation) *OperationObject {
+	o := &OperationObject{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Deprecated:  op.Deprecated,
+		Responses:   make(map[string]ResponseObject),
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range op.Parameters {
+		o.Parameters = append(o.Parameters, parameter(types, p))
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+	}
+
+	for _, match := range pathParamRegex.FindAllStringSubmatch(pattern, -1) {
+		if !declared[match[1]] {
+			o.Parameters = append(o.Parameters, parameter(types, Parameter{Name: match[1], In: "path"}))
+		}
+	}
+
+	if op.Request != nil {
+		o.RequestBody = &RequestBody{
+			Required: true,
+			Content:  jsonContent(types, op.Request),
+		}
+	}
+
+	for status, body := range op.Responses {
+		response := ResponseObject{Description: http.StatusText(status)}
+		if body != nil {
+			response.Content = jsonContent(types, body)
+		}
+
+		o.Responses[strconv.Itoa(status)] = response
+	}
+
+	if len(o.Responses) == 0 {
+		// a document needs at least one response for every operation
+		o.Responses["default"] = ResponseObject{Description: "Response"}
+	}
+
+	if op.Auth {
+		o.Security = []map[string][]string{{bearerAuth: {}}}
+	}
+
+	return o
+}
+
+// Handler serves the document of routes as json. The document is generated for every
+// request, so that routes added after the handler are in it too.
+func (s *Spec) Handler(routes chi.Routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc, err := s.Generate(routes)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(doc)
+	}
+}
+
+func parameter(types *schemas, p Parameter) ParameterObject {
+	schema := &Schema{Type: "string"}
+	if p.Type != nil {
+		schema = types.of(reflect.TypeOf(p.Type))
+	}
+
+	return ParameterObject{
+		Name:        p.Name,
+		In:          p.In,
+		Description: p.Description,
+		// path parameters are always required
+		Required: p.Required || p.In == "path",
+		Schema:   schema,
+	}
+}
+
+func jsonContent(types *schemas, body interface{}) map[string]MediaType {
+	return map[string]MediaType{
+		"application/json": {Schema: types.of(reflect.TypeOf(body))},
+	}
+}
+
+func operationKey(method, pattern string) string {
+	return strings.ToUpper(method) + " " + normalizePattern(pattern)
+}
+
+// normalizePattern removes the slash chi.Walk leaves at the end of the patterns of the root
+// routes of sub routers, e.g. /api/users/ for Get("/") in Route("/api/users")
+func normalizePattern(pattern string) string {
+	pattern = strings.ReplaceAll(pattern, "/*/", "/")
+	if len(pattern) > 1 {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	return pattern
+}
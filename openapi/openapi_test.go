@@ -0,0 +1,167 @@
+package openapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type testUser struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name" validate:"required,min=2,max=255"`
+	Email     string         `json:"email" validate:"required,email"`
+	Age       int            `json:"age" validate:"min=18"`
+	Nickname  sql.NullString `json:"nickname"`
+	Friends   []*testUser    `json:"friends"`
+	CreatedAt time.Time      `json:"created_at"`
+	Password  string         `json:"-"`
+	hidden    string
+}
+
+type testEmbedding struct {
+	testUser
+	Note string `json:"note,omitempty"`
+}
+
+func TestSchemas(t *testing.T) {
+	types := newSchemas()
+
+	schema := types.of(reflect.TypeOf(testUser{}))
+	if schema.Ref != "#/components/schemas/TestUser" {
+		t.Fatal("expected a reference to TestUser, got", schema.Ref)
+	}
+
+	user := types.components["TestUser"]
+
+	if strings.Join(user.Required, ",") != "name,email" {
+		t.Error("wrong required fields:", user.Required)
+	}
+
+	for _, name := range []string{"Password", "password", "hidden"} {
+		if _, ok := user.Properties[name]; ok {
+			t.Errorf("%s should not be a property", name)
+		}
+	}
+
+	name := user.Properties["name"]
+	if name.Type != "string" || *name.MinLength != 2 || *name.MaxLength != 255 {
+		t.Errorf("wrong name schema: %+v", name)
+	}
+
+	if user.Properties["email"].Format != "email" {
+		t.Error("email should have the email format")
+	}
+
+	if age := user.Properties["age"]; age.Type != "integer" || *age.Minimum != 18 {
+		t.Errorf("wrong age schema: %+v", age)
+	}
+
+	if nickname := user.Properties["nickname"]; nickname.Type != "string" || !nickname.Nullable {
+		t.Errorf("wrong nickname schema: %+v", nickname)
+	}
+
+	if friends := user.Properties["friends"]; friends.Type != "array" || friends.Items.Ref != "#/components/schemas/TestUser" {
+		t.Errorf("wrong friends schema: %+v", friends)
+	}
+
+	if created := user.Properties["created_at"]; created.Format != "date-time" {
+		t.Errorf("wrong created_at schema: %+v", created)
+	}
+
+	types.of(reflect.TypeOf(testEmbedding{}))
+	embedding := types.components["TestEmbedding"]
+	if _, ok := embedding.Properties["email"]; !ok || embedding.Properties["note"] == nil {
+		t.Errorf("embedded fields should be promoted: %+v", embedding.Properties)
+	}
+}
+
+func TestSpec_Generate(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	r.Route("/api/users", func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	spec := New("test", "1.0.0", "/api/")
+	spec.Describe(http.MethodGet, "/api/users", Operation{
+		Summary:   "List users",
+		Auth:      true,
+		Responses: Responses{http.StatusOK: []testUser{}},
+	})
+	spec.Describe(http.MethodPost, "/api/users", Operation{
+		Request:   testUser{},
+		Responses: Responses{http.StatusCreated: testUser{}, http.StatusNoContent: nil},
+	})
+
+	doc, err := spec.Generate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := doc.Paths["/"]; ok {
+		t.Error("routes outside the prefix should not be in the document")
+	}
+
+	list := doc.Paths["/api/users"]["get"]
+	if list == nil || list.Summary != "List users" || len(list.Security) != 1 {
+		t.Fatalf("wrong list operation: %+v", list)
+	}
+	if list.Responses["200"].Content["application/json"].Schema.Items.Ref != "#/components/schemas/TestUser" {
+		t.Errorf("wrong list response: %+v", list.Responses["200"])
+	}
+
+	create := doc.Paths["/api/users"]["post"]
+	if create == nil || create.RequestBody == nil || create.Responses["204"].Content != nil {
+		t.Fatalf("wrong create operation: %+v", create)
+	}
+
+	show := doc.Paths["/api/users/{id}"]["get"]
+	if show == nil || len(show.Parameters) != 1 || show.Parameters[0].Name != "id" || !show.Parameters[0].Required {
+		t.Fatalf("undescribed route should have its path parameter: %+v", show)
+	}
+	if _, ok := show.Responses["default"]; !ok {
+		t.Error("undescribed route should have a default response")
+	}
+
+	if doc.Components.SecuritySchemes[bearerAuth].Scheme != "bearer" {
+		t.Error("missing the bearer security scheme")
+	}
+}
+
+func TestSpec_Handler(t *testing.T) {
+	r := chi.NewRouter()
+	spec := New("test", "1.0.0", "/api/")
+	r.Get("/api/openapi.json", spec.Handler(r))
+	r.Get("/api/ping", func(w http.ResponseWriter, r *http.Request) {})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	var doc Document
+	err := json.Unmarshal(rr.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != Version || doc.Paths["/api/ping"]["get"] == nil {
+		t.Errorf("wrong document: %s", rr.Body.String())
+	}
+}
+
+func TestUIHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	UIHandler("test api", "/api/openapi.json").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+
+	if !strings.Contains(rr.Body.String(), `const specURL = "/api/openapi.json"`) {
+		t.Errorf("the page does not load the document: %s", rr.Body.String())
+	}
+}
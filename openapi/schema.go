@@ -0,0 +1,245 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI schema object, with the fields the derived schemas use
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemas derives schemas from Go types. Named structs are added to components once and
+// referenced with $ref, so that types used by many operations, or by themselves, are
+// described once.
+type schemas struct {
+	components map[string]*Schema
+	// names are the component names given to types, and the types given to names, to tell two
+	// types with the same name in different packages apart
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+		types:      make(map[string]reflect.Type),
+	}
+}
+
+// of returns the schema of the values of t
+func (s *schemas) of(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &Schema{}
+	case t.Kind() == reflect.Ptr:
+		schema := s.of(t.Elem())
+		if schema.Ref != "" {
+			// $ref can not have siblings in OpenAPI 3.0
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		// the json of the type is its own, there is nothing to derive
+		return &Schema{}
+	case t.Kind() == reflect.Struct && strings.HasPrefix(t.Name(), "Null") && t.PkgPath() == "database/sql":
+		// sql.NullString and friends are written as their value, or null
+		schema := s.of(t.Field(0).Type)
+		schema.Nullable = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes []byte as base64
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	}
+
+	// interfaces can hold anything
+	return &Schema{}
+}
+
+// component adds the schema of the named struct t to the components, and returns its name
+func (s *schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := exportedName(t.Name())
+	if other, taken := s.types[name]; taken && other != t {
+		// e.g. models.User and handlers.User
+		parts := strings.Split(t.PkgPath(), "/")
+		name = exportedName(parts[len(parts)-1]) + name
+	}
+
+	s.names[t] = name
+	s.types[name] = t
+	// the schema is added before its fields are derived, so that fields of type t refer to it
+	schema := &Schema{}
+	s.components[name] = schema
+	*schema = *s.object(t)
+
+	return name
+}
+
+// object returns the schema of the struct t, with the properties encoding/json writes
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	s.addFields(schema, t)
+
+	return schema
+}
+
+func (s *schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		// encoding/json promotes the fields of embedded structs without a name, exported or not
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			s.addFields(schema, fieldType)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.of(field.Type)
+		if applyRules(property, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+
+		schema.Properties[name] = property
+	}
+}
+
+// applyRules describes the validation rules in tag, see package validation, on schema, and
+// reports whether the field is required. Rules that have no OpenAPI equivalent are left out.
+func applyRules(schema *Schema, tag string) (required bool) {
+	if tag == "" || tag == "-" {
+		return false
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			setLimit(schema, name == "min", limit)
+		}
+	}
+
+	return required
+}
+
+// setLimit sets the minimum, or the maximum, that fits the type of schema
+func setLimit(schema *Schema, min bool, limit float64) {
+	n := int(limit)
+
+	switch schema.Type {
+	case "string":
+		if min {
+			schema.MinLength = &n
+		} else {
+			schema.MaxLength = &n
+		}
+	case "array":
+		if min {
+			schema.MinItems = &n
+		} else {
+			schema.MaxItems = &n
+		}
+	case "integer", "number":
+		if min {
+			schema.Minimum = &limit
+		} else {
+			schema.Maximum = &limit
+		}
+	}
+}
+
+// exportedName returns name with its first letter in upper case, e.g. UserResource for userResource
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
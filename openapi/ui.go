@@ -0,0 +1,26 @@
+package openapi
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed ui.html
+var uiSource string
+
+var uiTemplate = template.Must(template.New("ui").Parse(uiSource))
+
+// UIHandler serves a page that shows the document at specURL, with its operations, their
+// schemas and a form to try them, in the manner of Swagger UI. The page has no dependencies,
+// so it works without access to a CDN.
+func UIHandler(title, specURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		_ = uiTemplate.Execute(w, struct {
+			Title   string
+			SpecURL string
+		}{title, specURL})
+	}
+}
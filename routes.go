@@ -1,16 +1,26 @@
 package main
 
 import (
-	"fmt"
-	"myapp/data"
+	"myapp/apiversion"
+	"myapp/apperror"
+	"myapp/handlers"
+	"myapp/openapi"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
 func (route *application) routes() *chi.Mux {
+	route.App.Routes = route.newRouter()
+
 	// middleware must come before any routes
+	route.use(route.Middleware.QueryStats)
+	route.use(route.Middleware.StickyPrimary)
+	route.use(route.Middleware.AuditContext)
+	route.use(route.Middleware.URLFormat)
+	route.use(route.Middleware.APIVersion)
 
 	// add routes here
 	route.get("/", route.Handlers.Home)
@@ -22,6 +32,15 @@ func (route *application) routes() *chi.Mux {
 	route.get("/logout", route.Handlers.UserLogout)
 	route.get("/form", route.Handlers.Form)
 	route.post("/form", route.Handlers.PostForm)
+	route.App.Routes.With(route.Middleware.Auth).Get("/users/{id}/history", route.Handlers.Handle(route.Handlers.UserHistory))
+
+	// the internals of the app, for monitoring with the HEALTH_TOKEN
+	route.App.Routes.Route("/health", func(r chi.Router) {
+		r.Use(route.Middleware.Internal)
+
+		r.Get("/pools", route.Handlers.PoolStats)
+		r.Get("/api-versions", route.Handlers.APIVersionUsage)
+	})
 
 	route.get("/json", route.Handlers.Json)
 	route.get("/xml", route.Handlers.XML)
@@ -29,83 +48,28 @@ func (route *application) routes() *chi.Mux {
 	route.get("/crypto", route.Handlers.TestCrypto)
 
 	route.get("/cache-test", route.Handlers.ShowCachePage)
-	route.post("/api/save-in-cache", route.Handlers.SaveInCache)
-	route.post("/api/get-from-cache", route.Handlers.GetFromCache)
-	route.post("/api/delete-from-cache", route.Handlers.DeleteFromCache)
-	route.post("/api/empty-cache", route.Handlers.EmptyCache)
-
-	route.get("/create-user", func(w http.ResponseWriter, r *http.Request) {
-		// Create a new user
-		user := data.User{
-			FirstName: "Daota",
-			LastName:  "Nguyen",
-			Email:     "asd@asd.se",
-			Active:    1,
-			Password:  "password",
-		}
-
-		// Insert the user into the database
-		id, err := route.Models.Users.Create(user)
-		if err != nil {
-			route.App.ErrorLog.Println("error inserting user:", err)
-		}
-
-		route.App.InfoLog.Println("user inserted with id:", id)
-	})
-	route.get("/all-users", func(w http.ResponseWriter, r *http.Request) {
-		users, err := route.Models.Users.All()
-		if err != nil {
-			route.App.ErrorLog.Println("error getting all users:", err)
-		}
-
-		for _, x := range users {
-			route.App.InfoLog.Println("user:", x.FirstName, x.LastName, x.Email)
-		}
-	})
-	route.get("/user/{id}", func(w http.ResponseWriter, r *http.Request) {
-		id := chi.URLParam(r, "id")
-		user_id, err := strconv.Atoi(id)
-		if err != nil {
-			route.App.ErrorLog.Println("error converting id:", err)
-		}
-		user, err := route.Models.Users.Find(user_id)
-		if err != nil {
-			route.App.ErrorLog.Println("error getting user:", err)
-		}
-
-		route.App.InfoLog.Println("user:", user.FirstName, user.LastName, user.Email)
-	})
-	route.get("/update-user/{id}", func(w http.ResponseWriter, r *http.Request) {
-		id := chi.URLParam(r, "id")
-		user_id, err := strconv.Atoi(id)
-		if err != nil {
-			route.App.ErrorLog.Println("error converting id:", err)
-		}
-		oldUser, err := route.Models.Users.Find(user_id)
-		if err != nil {
-			route.App.ErrorLog.Println("error getting user:", err)
-		}
-
-		oldUser.FirstName = "Daota"
-		oldUser.LastName = ""
-		oldUser.Email = ""
-
-		validator := route.App.Validator(nil)
-		oldUser.Validate(validator)
-
-		if !validator.Valid() {
-			fmt.Fprint(w, validator.Errors)
-			return
-		}
-
-		user, err := route.Models.Users.Update(*oldUser)
-		if err != nil {
-			route.App.ErrorLog.Println("error updating user:", err)
-		}
-
-		route.App.InfoLog.Println("user updated:", user.FirstName, user.LastName, user.Email)
+	route.post("/api/save-in-cache", route.Handlers.Handle(route.Handlers.SaveInCache))
+	route.post("/api/get-from-cache", route.Handlers.Handle(route.Handlers.GetFromCache))
+	route.post("/api/delete-from-cache", route.Handlers.Handle(route.Handlers.DeleteFromCache))
+	route.post("/api/empty-cache", route.Handlers.Handle(route.Handlers.EmptyCache))
 
-	})
+	// the api, a route group for every version, /api/v1 and /api/v2, see middleware.APIVersion
+	for _, version := range route.Middleware.APIVersions {
+		version := version
+		prefix := "/api/" + version.Name
+
+		route.App.Routes.Route(prefix, func(r chi.Router) {
+			r.Use(route.Middleware.Version(version))
+
+			// v2 serves the users like v1, until their shape changes
+			r.Route("/users", route.usersAPI)
+		})
+		route.describeUsersAPI(prefix, version)
+	}
+
+	// the api document and a page to read and try it
+	route.get("/api/openapi.json", route.API.Handler(route.App.Routes))
+	route.get("/api/docs", openapi.UIHandler(route.API.Title, "/api/openapi.json"))
 
 	route.get("/jet", func(w http.ResponseWriter, r *http.Request) {
 		route.App.Render.JetPage(w, r, "testjet", nil, nil)
@@ -117,3 +81,116 @@ func (route *application) routes() *chi.Mux {
 
 	return route.App.Routes
 }
+
+// newRouter returns a router with the middleware of the router of Gemquick, but with the NoSurf
+// of the app, which leaves everything under /api/ to the api's own authentication
+func (route *application) newRouter() *chi.Mux {
+	mux := chi.NewRouter()
+	mux.Use(chimiddleware.RequestID)
+	mux.Use(chimiddleware.RealIP)
+
+	if route.App.Debug {
+		mux.Use(chimiddleware.Logger)
+	}
+
+	mux.Use(chimiddleware.Recoverer)
+	mux.Use(route.App.Session.LoadAndSave)
+	mux.Use(route.Middleware.NoSurf)
+
+	return mux
+}
+
+// usersAPI registers the routes of the users api, authenticated with a token in the
+// Authorization header
+func (route *application) usersAPI(r chi.Router) {
+	r.Use(route.Middleware.AuthToken)
+
+	r.Get("/", route.Handlers.Handle(route.Handlers.UsersIndex))
+	r.Post("/", route.Handlers.Handle(route.Handlers.UsersStore))
+	r.Get("/{id}", route.Handlers.Handle(route.Handlers.UsersShow))
+	r.Put("/{id}", route.Handlers.Handle(route.Handlers.UsersUpdate))
+	r.Delete("/{id}", route.Handlers.Handle(route.Handlers.UsersDestroy))
+}
+
+// describeUsersAPI describes the routes of the users api of version, under prefix, in the api
+// document. The operation ids end in the version, e.g. listUsersV1, they must be unique.
+func (route *application) describeUsersAPI(prefix string, version apiversion.Version) {
+	userID := []openapi.Parameter{{Name: "id", In: "path", Description: "the id of the user", Type: 0}}
+	tags := []string{"users"}
+	suffix := strings.ToUpper(version.Name)
+	deprecated := version.IsDeprecated()
+
+	route.describe(http.MethodGet, prefix+"/users", openapi.Operation{
+		ID:         "listUsers" + suffix,
+		Summary:    "List the users, newest first",
+		Tags:       tags,
+		Deprecated: deprecated,
+		Auth:       true,
+		Responses: openapi.Responses{
+			http.StatusOK:           []handlers.UserResource{},
+			http.StatusUnauthorized: apperror.Problem{},
+		},
+	})
+
+	route.describe(http.MethodPost, prefix+"/users", openapi.Operation{
+		ID:         "createUser" + suffix,
+		Summary:    "Create a user",
+		Tags:       tags,
+		Deprecated: deprecated,
+		Auth:       true,
+		Request:    handlers.UserStoreRequest{},
+		Responses: openapi.Responses{
+			http.StatusCreated:             handlers.UserResource{},
+			http.StatusBadRequest:          apperror.Problem{},
+			http.StatusUnauthorized:        apperror.Problem{},
+			http.StatusUnprocessableEntity: apperror.Problem{},
+		},
+	})
+
+	route.describe(http.MethodGet, prefix+"/users/{id}", openapi.Operation{
+		ID:         "showUser" + suffix,
+		Summary:    "Show a user",
+		Tags:       tags,
+		Deprecated: deprecated,
+		Auth:       true,
+		Parameters: userID,
+		Responses: openapi.Responses{
+			http.StatusOK:           handlers.UserResource{},
+			http.StatusUnauthorized: apperror.Problem{},
+			http.StatusNotFound:     apperror.Problem{},
+		},
+	})
+
+	route.describe(http.MethodPut, prefix+"/users/{id}", openapi.Operation{
+		ID:          "updateUser" + suffix,
+		Summary:     "Update a user",
+		Description: "With a version the update fails with 409 when the user has been updated since that version.",
+		Tags:        tags,
+		Deprecated:  deprecated,
+		Auth:        true,
+		Parameters:  userID,
+		Request:     handlers.UserUpdateRequest{},
+		Responses: openapi.Responses{
+			http.StatusOK:                  handlers.UserResource{},
+			http.StatusBadRequest:          apperror.Problem{},
+			http.StatusUnauthorized:        apperror.Problem{},
+			http.StatusNotFound:            apperror.Problem{},
+			http.StatusConflict:            handlers.UserResource{},
+			http.StatusUnprocessableEntity: apperror.Problem{},
+		},
+	})
+
+	route.describe(http.MethodDelete, prefix+"/users/{id}", openapi.Operation{
+		ID:         "deleteUser" + suffix,
+		Summary:    "Delete a user",
+		Tags:       tags,
+		Deprecated: deprecated,
+		Auth:       true,
+		Parameters: userID,
+		Responses: openapi.Responses{
+			http.StatusNoContent:    nil,
+			http.StatusUnauthorized: apperror.Problem{},
+			http.StatusNotFound:     apperror.Problem{},
+		},
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"myapp/data"
+	"myapp/handlers"
+	"myapp/middleware"
+	"myapp/openapi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoutes_APIWithoutCSRFCookie(t *testing.T) {
+	gem := newSQLiteGemquick(t)
+
+	_, err := data.NewMigrator(gem.DB.Pool, "migrations").Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := apiVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := data.New(gem.DB.Pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		App:        gem,
+		Handlers:   &handlers.Handlers{App: gem, Models: models, APIVersions: versions},
+		Models:     models,
+		Middleware: &middleware.Middleware{App: gem, Models: models, APIVersions: versions},
+		API:        openapi.New("test api", "1.0.0", "/api/"),
+	}
+	routes := app.routes()
+
+	user, err := models.Users.Create(data.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: "password", Active: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := models.Tokens.GenerateToken(user.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Tokens.Insert(*token, *user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the api is authenticated with the token, the requests have no csrf cookie or token
+	for _, version := range []string{"v1", "v2"} {
+		prefix := "/api/" + version + "/users"
+
+		created, err := models.Users.Create(data.User{FirstName: "Grace", LastName: "Hopper", Email: version + "@example.com", Password: "password", Active: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var tests = []struct {
+			method, path, body string
+			status             int
+		}{
+			{http.MethodPost, prefix, `{"first_name": "Alan", "last_name": "Turing", "email": "alan.` + version + `@example.com", "password": "password"}`, http.StatusCreated},
+			{http.MethodPut, fmt.Sprintf("%s/%d", prefix, user.ID), `{"first_name": "Ada", "last_name": "King", "email": "ada@example.com"}`, http.StatusOK},
+			{http.MethodDelete, fmt.Sprintf("%s/%d", prefix, created.ID), "", http.StatusNoContent},
+		}
+
+		for _, e := range tests {
+			r := httptest.NewRequest(e.method, e.path, strings.NewReader(e.body))
+			r.Header.Set("Authorization", "Bearer "+token.PlainText)
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			routes.ServeHTTP(w, r)
+
+			if w.Code != e.status {
+				t.Errorf("%s %s: expected %d, got %d: %s", e.method, e.path, e.status, w.Code, w.Body)
+			}
+		}
+	}
+
+	// the pages still need the csrf token
+	r := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader("email=ada@example.com"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	routes.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a form post without a csrf token to fail with 400, got %d", w.Code)
+	}
+}
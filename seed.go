@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// seed runs the seeders named in args, or all of them when there are none. The development
+// seeders, like the admin with a known password, only run when APP_ENV is development or test,
+// or when args has --force.
+func (a *application) seed(args []string) error {
+	env := os.Getenv("APP_ENV")
+	development := env == "development" || env == "test"
+
+	var names []string
+	for _, arg := range args {
+		if arg == "--force" {
+			development = true
+			continue
+		}
+
+		names = append(names, arg)
+	}
+
+	err := a.Models.Seed(context.Background(), development, names...)
+	if err != nil {
+		return err
+	}
+
+	a.App.InfoLog.Println("database seeded")
+
+	return nil
+}
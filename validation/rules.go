@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	RegisterRule("required", requiredRule)
+	RegisterRule("min", minRule)
+	RegisterRule("max", maxRule)
+	RegisterRule("email", emailRule)
+	RegisterRule("confirmed", confirmedRule)
+	RegisterRule("different", differentRule)
+}
+
+// requiredRule fails fields that are empty, strings with only spaces are empty too
+func requiredRule(f Field) string {
+	if f.Value.IsZero() || (f.Value.Kind() == reflect.String && strings.TrimSpace(f.Value.String()) == "") {
+		return "this field is required"
+	}
+
+	return ""
+}
+
+// minRule fails strings shorter than, numbers smaller than and slices with fewer elements than the param
+func minRule(f Field) string {
+	size, isLength := measure(f)
+	limit := param(f)
+
+	if size >= limit {
+		return ""
+	}
+
+	if isLength && f.Value.Kind() == reflect.String {
+		return fmt.Sprintf("%s must be at least %s characters long", f.Label, f.Param)
+	} else if isLength {
+		return fmt.Sprintf("%s must have at least %s items", f.Label, f.Param)
+	}
+
+	return fmt.Sprintf("%s must be at least %s", f.Label, f.Param)
+}
+
+// maxRule fails strings longer than, numbers larger than and slices with more elements than the param
+func maxRule(f Field) string {
+	size, isLength := measure(f)
+	limit := param(f)
+
+	if size <= limit {
+		return ""
+	}
+
+	if isLength && f.Value.Kind() == reflect.String {
+		return fmt.Sprintf("%s must be at most %s characters long", f.Label, f.Param)
+	} else if isLength {
+		return fmt.Sprintf("%s must have at most %s items", f.Label, f.Param)
+	}
+
+	return fmt.Sprintf("%s must be at most %s", f.Label, f.Param)
+}
+
+// emailRule fails strings that are not an email address
+func emailRule(f Field) string {
+	address, err := mail.ParseAddress(f.Value.String())
+	if err != nil || address.Address != f.Value.String() {
+		return "invalid email address"
+	}
+
+	return ""
+}
+
+// confirmedRule fails fields that differ from their confirmation, the field named by the param or
+// the field with the same name followed by Confirmation
+func confirmedRule(f Field) string {
+	name := f.Param
+	if name == "" {
+		name = f.StructField.Name + "Confirmation"
+	}
+
+	other := otherField(f, name)
+	if !reflect.DeepEqual(f.Value.Interface(), other.Interface()) {
+		return fmt.Sprintf("%s does not match its confirmation", f.Label)
+	}
+
+	return ""
+}
+
+// differentRule fails fields that are equal to the field named by the param
+func differentRule(f Field) string {
+	other := otherField(f, f.Param)
+	if reflect.DeepEqual(f.Value.Interface(), other.Interface()) {
+		return fmt.Sprintf("%s must be different from %s", f.Label, label(f.Param))
+	}
+
+	return ""
+}
+
+// otherField returns the field of f's struct named name, either its Go name or the name errors
+// are added under. Naming a field that does not exist is a mistake in the tag, so it panics.
+func otherField(f Field, name string) reflect.Value {
+	if value := f.Struct.FieldByName(name); value.IsValid() {
+		return value
+	}
+
+	structType := f.Struct.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		if FieldName(structType.Field(i)) == name {
+			return f.Struct.Field(i)
+		}
+	}
+
+	panic(fmt.Sprintf("validation: %s.%s refers to unknown field %q", structType.Name(), f.StructField.Name, name))
+}
+
+// measure returns the size min and max compare, the length of strings, slices and maps and the
+// value of numbers. isLength tells which one it is.
+func measure(f Field) (size float64, isLength bool) {
+	value := reflect.Indirect(f.Value)
+
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false
+	}
+
+	panic(fmt.Sprintf("validation: %s has no size to compare", f.StructField.Name))
+}
+
+// param returns the param of f as a number, a param that is not a number is a mistake in the tag
+func param(f Field) float64 {
+	limit, err := strconv.ParseFloat(f.Param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: %s needs a number, not %q", f.StructField.Name, f.Param))
+	}
+
+	return limit
+}
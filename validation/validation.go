@@ -0,0 +1,168 @@
+// Package validation validates structs by the rules in their validate tags, and adds the
+// errors to a gemquick.Validation, so that they end up in the same Errors map the templates read.
+//
+//	type SignUp struct {
+//		Email                string `json:"email" validate:"required,email,max=255"`
+//		Password             string `json:"password" validate:"required,min=8,confirmed"`
+//		PasswordConfirmation string `json:"password_confirmation"`
+//	}
+//
+// The errors are added under the name of the field in its form, json or db tag, in that order,
+// or under the field name in lower case when it has none of them.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jimmitjoo/gemquick"
+)
+
+// Field is the field a rule checks
+type Field struct {
+	// Name is the key errors for the field are added under
+	Name string
+	// Label is the name of the field for people, e.g. "First name"
+	Label string
+	// Value is the value of the field
+	Value reflect.Value
+	// Param is what follows the = of the rule in the tag, e.g. "2" for min=2
+	Param string
+	// Struct is the struct the field belongs to, for rules that compare fields
+	Struct reflect.Value
+	// StructField is the definition of the field in the struct
+	StructField reflect.StructField
+
+	// err is where Fail keeps the error for Struct to return
+	err *error
+}
+
+// Fail makes Struct return err, for rules that could not check the field, e.g. because a
+// database query failed. The rule should return "", the field is not what is wrong.
+func (f Field) Fail(err error) {
+	if f.err != nil && *f.err == nil {
+		*f.err = err
+	}
+}
+
+// Rule checks a field and returns the error message when the field fails, or "" when it passes
+type Rule func(f Field) string
+
+// Rules are rules by the name they have in validate tags
+type Rules map[string]Rule
+
+var (
+	rulesMu sync.RWMutex
+	rules   = Rules{}
+)
+
+// RegisterRule makes a rule available to validate tags under name, registering a name twice
+// replaces the first rule. The built in rules can be replaced the same way.
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = rule
+}
+
+func lookupRule(name string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+// Struct validates the fields of s, a struct or a pointer to one, by the rules in their
+// validate tags. The first rule a field fails adds an error for it to v. Fields that are
+// empty are only checked by required, so optional fields can have rules too. Struct panics
+// on rules that are not registered, since that is a mistake in the tag. The error is the
+// first one a rule could not check a field with, see Field.Fail.
+func Struct(v *gemquick.Validation, s interface{}) error {
+	return StructWithRules(v, s, nil)
+}
+
+// StructWithRules validates s like Struct does, with extra taking precedence over the registered
+// rules. It is meant for rules that need state, like a database session, that the registered
+// rules can not have.
+func StructWithRules(v *gemquick.Validation, s interface{}, extra Rules) error {
+	value := reflect.Indirect(reflect.ValueOf(s))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: Struct needs a struct, not %T", s))
+	}
+
+	structType := value.Type()
+
+	var err error
+
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+
+		tag := structField.Tag.Get("validate")
+		if tag == "" || tag == "-" || structField.PkgPath != "" {
+			continue
+		}
+
+		name := FieldName(structField)
+		field := Field{
+			Name:        name,
+			Label:       label(name),
+			Value:       value.Field(i),
+			Struct:      value,
+			StructField: structField,
+			err:         &err,
+		}
+
+		for _, ruleTag := range strings.Split(tag, ",") {
+			ruleName, param := ruleTag, ""
+			if i := strings.Index(ruleTag, "="); i >= 0 {
+				ruleName, param = ruleTag[:i], ruleTag[i+1:]
+			}
+
+			rule, ok := extra[ruleName]
+			if !ok {
+				rule, ok = lookupRule(ruleName)
+			}
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", ruleName, structType.Name(), structField.Name))
+			}
+
+			if ruleName != "required" && field.Value.IsZero() {
+				continue
+			}
+
+			field.Param = param
+
+			if message := rule(field); message != "" {
+				v.AddError(name, message)
+				break
+			}
+		}
+	}
+
+	return err
+}
+
+// FieldName returns the name errors for field are added under
+func FieldName(field reflect.StructField) string {
+	for _, key := range []string{"form", "json", "db"} {
+		name := strings.Split(field.Tag.Get(key), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return strings.ToLower(field.Name)
+}
+
+// label turns the name of a field into one for people, first_name becomes First name
+func label(name string) string {
+	name = strings.ReplaceAll(name, "_", " ")
+	if name == "" {
+		return name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jimmitjoo/gemquick"
+)
+
+type signUp struct {
+	FirstName            string   `json:"first_name" validate:"required,min=2,max=10"`
+	Email                string   `form:"mail" json:"email" validate:"required,email"`
+	Nickname             string   `validate:"min=3"`
+	Age                  int      `json:"age" validate:"min=18"`
+	Password             string   `json:"password" validate:"required,confirmed,different=Email"`
+	PasswordConfirmation string   `json:"password_confirmation"`
+	Tags                 []string `json:"tags" validate:"max=2"`
+}
+
+func newValidation() *gemquick.Validation {
+	return &gemquick.Validation{Errors: make(map[string]string)}
+}
+
+func validSignUp() signUp {
+	return signUp{
+		FirstName:            "Alice",
+		Email:                "alice@example.com",
+		Age:                  30,
+		Password:             "secret",
+		PasswordConfirmation: "secret",
+	}
+}
+
+func TestStruct(t *testing.T) {
+	var tests = []struct {
+		name    string
+		change  func(s *signUp)
+		field   string
+		message string
+	}{
+		{"required", func(s *signUp) { s.FirstName = "  " }, "first_name", "this field is required"},
+		{"min length", func(s *signUp) { s.FirstName = "A" }, "first_name", "First name must be at least 2 characters long"},
+		{"max length", func(s *signUp) { s.FirstName = "Alexandrina" }, "first_name", "First name must be at most 10 characters long"},
+		{"email", func(s *signUp) { s.Email = "alice" }, "mail", "invalid email address"},
+		{"optional", func(s *signUp) { s.Nickname = "Al" }, "nickname", "Nickname must be at least 3 characters long"},
+		{"min number", func(s *signUp) { s.Age = 17 }, "age", "Age must be at least 18"},
+		{"max items", func(s *signUp) { s.Tags = []string{"a", "b", "c"} }, "tags", "Tags must have at most 2 items"},
+		{"confirmed", func(s *signUp) { s.PasswordConfirmation = "secret2" }, "password", "Password does not match its confirmation"},
+		{"different", func(s *signUp) {
+			s.Password = s.Email
+			s.PasswordConfirmation = s.Email
+		}, "password", "Password must be different from Email"},
+	}
+
+	for _, e := range tests {
+		s := validSignUp()
+		e.change(&s)
+
+		v := newValidation()
+		Struct(v, &s)
+
+		if len(v.Errors) != 1 || v.Errors[e.field] != e.message {
+			t.Errorf("%s: expected %s: %q but got %v", e.name, e.field, e.message, v.Errors)
+		}
+	}
+}
+
+func TestStruct_Valid(t *testing.T) {
+	s := validSignUp()
+
+	v := newValidation()
+	Struct(v, s)
+
+	if !v.Valid() {
+		t.Error("valid struct has errors", v.Errors)
+	}
+}
+
+func TestStruct_FirstErrorOnly(t *testing.T) {
+	v := newValidation()
+	Struct(v, &signUp{})
+
+	if v.Errors["first_name"] != "this field is required" {
+		t.Error("wrong error for an empty required field", v.Errors["first_name"])
+	}
+
+	if _, ok := v.Errors["age"]; ok {
+		t.Error("empty optional field was validated")
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("lowercase", func(f Field) string {
+		if f.Value.String() != strings.ToLower(f.Value.String()) {
+			return f.Label + " must be in lower case"
+		}
+		return ""
+	})
+	defer func() {
+		rulesMu.Lock()
+		delete(rules, "lowercase")
+		rulesMu.Unlock()
+	}()
+
+	var s struct {
+		Username string `json:"user_name" validate:"lowercase"`
+	}
+	s.Username = "Alice"
+
+	v := newValidation()
+	Struct(v, &s)
+
+	if v.Errors["user_name"] != "User name must be in lower case" {
+		t.Error("custom rule was not applied", v.Errors)
+	}
+}
+
+func TestStructWithRules_Fail(t *testing.T) {
+	down := errors.New("the database is down")
+	rules := Rules{"checked": func(f Field) string {
+		f.Fail(down)
+		return ""
+	}}
+
+	var s struct {
+		Email string `json:"email" validate:"required,checked"`
+	}
+	s.Email = "ada@example.com"
+
+	v := newValidation()
+	err := StructWithRules(v, &s, rules)
+
+	if !errors.Is(err, down) {
+		t.Errorf("expected the error of the rule, got %v", err)
+	}
+
+	if !v.Valid() {
+		t.Error("a field that could not be checked got an error:", v.Errors)
+	}
+}
+
+func TestStruct_UnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown rule did not panic")
+		}
+	}()
+
+	var s struct {
+		Name string `validate:"nonsense"`
+	}
+	s.Name = "x"
+
+	Struct(newValidation(), &s)
+}